@@ -11,30 +11,77 @@ import (
 type options struct {
 	// TODO: Verbose or Debug mode? Or both?
 	// TODO: Do we need `--dry-run` and/or `--interactive` flags?
-	force bool
-	key   string
+	force     bool
+	key       string
+	branch    string
+	author    string
+	committer string
+	trailers  []string
+	noSign    bool
+	cache     bool
 }
 
 func New() *cobra.Command {
 	opts := &options{}
 	cmd := &cobra.Command{
-		Use:   "apply",
+		Use:   "apply <plan|->",
 		Short: "Applies configuration onto repositories.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			e, err := engine.NewFromFile(args[0])
+			// NOTE: Prompts are answered on stdin so it cannot also hold the plan
+			if args[0] == "-" && !opts.force {
+				return fmt.Errorf("reading the plan from stdin requires --force")
+			}
+			engines, err := engine.NewFromFile(args[0])
 			if err != nil {
 				return fmt.Errorf("create engine: %w", err)
 			}
-			e.SetForce(opts.force)
-			e.SetKey(opts.key)
-			if err := e.Execute(); err != nil {
-				return fmt.Errorf("execute plan: %w", err)
+			if opts.key != "" && len(engines) > 1 {
+				return fmt.Errorf("--key cannot be used with %d plans", len(engines))
+			}
+			var cache *engine.Cache
+			if opts.cache {
+				dir, err := engine.DefaultCacheDir()
+				if err != nil {
+					return fmt.Errorf("get cache dir: %w", err)
+				}
+				if cache, err = engine.NewCache(dir); err != nil {
+					return fmt.Errorf("open cache: %w", err)
+				}
+			}
+			for _, e := range engines {
+				e.SetCache(cache)
+				e.SetForce(opts.force)
+				e.SetNoSign(opts.noSign)
+				if err := e.SetKey(opts.key); err != nil {
+					return fmt.Errorf("set key: %w", err)
+				}
+				if err := e.SetBranch(opts.branch); err != nil {
+					return fmt.Errorf("set branch: %w", err)
+				}
+				if err := e.SetAuthor(opts.author); err != nil {
+					return fmt.Errorf("set author: %w", err)
+				}
+				if err := e.SetCommitter(opts.committer); err != nil {
+					return fmt.Errorf("set committer: %w", err)
+				}
+				if err := e.AddTrailers(opts.trailers...); err != nil {
+					return fmt.Errorf("add trailers: %w", err)
+				}
+				if err := e.Execute(); err != nil {
+					return fmt.Errorf("execute plan: %w", err)
+				}
 			}
 			return nil
 		},
 	}
 	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "skips any interactive prompts")
 	cmd.Flags().StringVarP(&opts.key, "key", "k", "", "override the default id key")
+	cmd.Flags().StringVar(&opts.branch, "branch", "", "override the branch template, e.g. bulk/{{ .Plan.ID }}")
+	cmd.Flags().StringVar(&opts.author, "author", "", "override the commit author, as Name <email>")
+	cmd.Flags().StringVar(&opts.committer, "committer", "", "override the commit committer, as Name <email>")
+	cmd.Flags().BoolVar(&opts.cache, "cache", false, "fetch repositories through mirrors kept in the cache dir")
+	cmd.Flags().BoolVar(&opts.noSign, "no-sign", false, "disable commit signing regardless of the plan and git config")
+	cmd.Flags().StringArrayVar(&opts.trailers, "trailer", nil, "add a commit trailer, as Key: value")
 	return cmd
 }
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loozhengyuan/bulk/internal/engine"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manages the cache of repository mirrors.",
+	}
+	cmd.AddCommand(newPrune())
+	return cmd
+}
+
+type pruneOptions struct {
+	olderThan time.Duration
+	all       bool
+}
+
+func newPrune() *cobra.Command {
+	opts := &pruneOptions{}
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Removes mirrors that have not been used recently.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := engine.DefaultCacheDir()
+			if err != nil {
+				return fmt.Errorf("get cache dir: %w", err)
+			}
+			c, err := engine.NewCache(dir)
+			if err != nil {
+				return fmt.Errorf("open cache: %w", err)
+			}
+
+			before := time.Now().Add(-opts.olderThan)
+			if opts.all {
+				before = time.Now()
+			}
+			pruned, err := c.Prune(before)
+			for _, p := range pruned {
+				fmt.Fprintf(os.Stdout, "Removed %s\n", p)
+			}
+			if err != nil {
+				return fmt.Errorf("prune cache: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&opts.olderThan, "older-than", 30*24*time.Hour, "minimum time since the mirrors were last used")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "removes all mirrors that are not in use")
+	return cmd
+}
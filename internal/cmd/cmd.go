@@ -4,6 +4,11 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/loozhengyuan/bulk/internal/cmd/apply"
+	"github.com/loozhengyuan/bulk/internal/cmd/cache"
+	"github.com/loozhengyuan/bulk/internal/cmd/initialize"
+	"github.com/loozhengyuan/bulk/internal/cmd/migrate"
+	"github.com/loozhengyuan/bulk/internal/cmd/render"
+	"github.com/loozhengyuan/bulk/internal/cmd/validate"
 	"github.com/loozhengyuan/bulk/internal/cmd/version"
 )
 
@@ -18,6 +23,11 @@ func New() (*cobra.Command, error) {
 		},
 	}
 	cmd.AddCommand(apply.New())
+	cmd.AddCommand(cache.New())
+	cmd.AddCommand(initialize.New())
+	cmd.AddCommand(migrate.New())
+	cmd.AddCommand(render.New())
+	cmd.AddCommand(validate.New())
 	cmd.AddCommand(version.New())
 	return cmd, nil
 }
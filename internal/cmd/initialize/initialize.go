@@ -0,0 +1,113 @@
+package initialize
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loozhengyuan/bulk/internal/engine"
+)
+
+type options struct {
+	template    string
+	interactive bool
+}
+
+func New() *cobra.Command {
+	opts := &options{}
+	cmd := &cobra.Command{
+		Use:   "init [plan|-]",
+		Short: "Creates a new plan from a template.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := "plan.yml"
+			if len(args) > 0 {
+				name = args[0]
+			}
+			if name != "-" {
+				// NOTE: Existing plans are never overwritten
+				if _, err := os.Stat(name); err == nil {
+					return fmt.Errorf("%s already exists", name)
+				} else if !errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("stat file: %w", err)
+				}
+			}
+
+			so := engine.ScaffoldOptions{Template: opts.template}
+			if opts.interactive {
+				if err := prompt(&so); err != nil {
+					return fmt.Errorf("prompt options: %w", err)
+				}
+			}
+			b, err := engine.ScaffoldPlan(so)
+			if err != nil {
+				return fmt.Errorf("scaffold plan: %w", err)
+			}
+
+			if name == "-" {
+				if _, err := os.Stdout.Write(b); err != nil {
+					return fmt.Errorf("output plan: %w", err)
+				}
+				return nil
+			}
+			if err := os.WriteFile(name, b, 0644); err != nil {
+				return fmt.Errorf("write file: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "%s is created\n", name)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&opts.template, "template", "t", "script", fmt.Sprintf("template of the steps, one of: %s", strings.Join(engine.ScaffoldTemplates(), ", ")))
+	cmd.Flags().BoolVarP(&opts.interactive, "interactive", "i", false, "prompts for the targeted repositories and commit title")
+	return cmd
+}
+
+// prompt asks for the options of the plan on stdin. Unanswered options keep
+// their defaults.
+func prompt(so *engine.ScaffoldOptions) error {
+	r := bufio.NewReader(os.Stdin)
+	ask := func(question string) (string, error) {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
+		input, err := r.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("read input: %w", err)
+		}
+		return strings.TrimSpace(input), nil
+	}
+
+	templates := engine.ScaffoldTemplates()
+	for {
+		input, err := ask(fmt.Sprintf("Template (%s) [%s]", strings.Join(templates, ", "), so.Template))
+		if err != nil {
+			return err
+		}
+		if input == "" || slices.Contains(templates, input) {
+			if input != "" {
+				so.Template = input
+			}
+			break
+		}
+	}
+	input, err := ask("Repositories, separated by commas (owner/repo)")
+	if err != nil {
+		return err
+	}
+	for _, repo := range strings.Split(input, ",") {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			so.Repositories = append(so.Repositories, repo)
+		}
+	}
+	if so.Search, err = ask("Code search query for repositories"); err != nil {
+		return err
+	}
+	if so.Title, err = ask("Commit title"); err != nil {
+		return err
+	}
+	return nil
+}
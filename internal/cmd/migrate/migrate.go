@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loozhengyuan/bulk/internal/engine"
+)
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate <plan|->",
+		Short: "Migrates configuration to the latest version.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			b, migrated, err := engine.MigrateFile(name)
+			if err != nil {
+				return fmt.Errorf("migrate plan: %w", err)
+			}
+
+			// NOTE: Plans read from stdin are always written to stdout so that
+			// the command can be used in pipelines
+			if name == "-" {
+				if _, err := os.Stdout.Write(b); err != nil {
+					return fmt.Errorf("output plan: %w", err)
+				}
+				return nil
+			}
+			if !migrated {
+				fmt.Fprintf(os.Stderr, "%s is already at version %d\n", name, engine.LatestPlanVersion())
+				return nil
+			}
+			info, err := os.Stat(name)
+			if err != nil {
+				return fmt.Errorf("stat file: %w", err)
+			}
+			if err := os.WriteFile(name, b, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("write file: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "%s is migrated to version %d\n", name, engine.LatestPlanVersion())
+			return nil
+		},
+	}
+	return cmd
+}
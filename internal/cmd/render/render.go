@@ -0,0 +1,66 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+
+	"github.com/loozhengyuan/bulk/internal/engine"
+)
+
+type options struct {
+	format string
+}
+
+func New() *cobra.Command {
+	opts := &options{}
+	cmd := &cobra.Command{
+		Use:   "render <plan|->",
+		Short: "Prints configuration with its base plans and includes resolved.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plans, err := engine.NewPlansFromFile(args[0])
+			if err != nil {
+				return fmt.Errorf("parse plan: %w", err)
+			}
+
+			switch opts.format {
+			case "yaml":
+				for i, p := range plans {
+					b, err := json.Marshal(p)
+					if err != nil {
+						return fmt.Errorf("encode plan: %w", err)
+					}
+					// NOTE: Plans are encoded as JSON first to encode steps
+					// with their operators
+					y, err := yaml.JSONToYAML(b)
+					if err != nil {
+						return fmt.Errorf("convert yaml: %w", err)
+					}
+					if i > 0 {
+						y = append([]byte("---\n"), y...)
+					}
+					if _, err := os.Stdout.Write(y); err != nil {
+						return fmt.Errorf("output yaml: %w", err)
+					}
+				}
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				for _, p := range plans {
+					if err := enc.Encode(p); err != nil {
+						return fmt.Errorf("output json: %v", err)
+					}
+				}
+			default:
+				return fmt.Errorf("unknown format value: %s", opts.format)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&opts.format, "format", "f", "yaml", "output format")
+	return cmd
+}
@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loozhengyuan/bulk/internal/engine"
+)
+
+type options struct {
+	format string
+}
+
+// output is the document written in the json format.
+type output struct {
+	Valid       bool                `json:"valid"`
+	Diagnostics []engine.Diagnostic `json:"diagnostics"`
+}
+
+func New() *cobra.Command {
+	opts := &options{}
+	cmd := &cobra.Command{
+		Use:   "validate <plan|->",
+		Short: "Validates configuration without applying it.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diags, err := engine.ValidateFile(args[0])
+			if err != nil {
+				return fmt.Errorf("validate plan: %w", err)
+			}
+			var errs int
+			for _, d := range diags {
+				if d.Severity == engine.SeverityError {
+					errs++
+				}
+			}
+
+			switch opts.format {
+			case "text":
+				for _, d := range diags {
+					fmt.Fprintln(os.Stdout, d)
+				}
+			case "json":
+				out := output{
+					Valid:       errs == 0,
+					Diagnostics: diags,
+				}
+				if out.Diagnostics == nil {
+					out.Diagnostics = []engine.Diagnostic{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(out); err != nil {
+					return fmt.Errorf("output json: %v", err)
+				}
+			default:
+				return fmt.Errorf("unknown format value: %s", opts.format)
+			}
+
+			if errs > 0 {
+				return fmt.Errorf("plan has %d error(s)", errs)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&opts.format, "format", "f", "text", "output format")
+	return cmd
+}
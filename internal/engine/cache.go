@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// cacheHeadRef is the ref of mirrors holding the default branch of their
+// remote, as mirrors only keep what runs need.
+const cacheHeadRef = "refs/bulk/HEAD"
+
+// cacheMirrorSuffix is the suffix of the directories of mirrors.
+const cacheMirrorSuffix = ".git"
+
+// cacheGCAuto is the threshold of loose objects for collecting the garbage of
+// mirrors, which is the default of Git.
+const cacheGCAuto = "6700"
+
+// NOTE: Each mirror has two locks. The update lock is held exclusively while
+// the mirror is created or fetched into, and the use lock is shared by runs
+// for as long as their worktrees borrow its objects. Removing a mirror or
+// collecting its garbage requires both locks exclusively.
+const (
+	cacheUpdateLockSuffix = ".lock"
+	cacheUseLockSuffix    = ".use.lock"
+)
+
+// unsafeSlugChars matches characters replaced in the names of mirrors.
+var unsafeSlugChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Cache keeps bare mirrors of remotes, so that repositories are only fetched
+// in full once. Worktrees borrow the objects of the mirrors as alternates.
+type Cache struct {
+	dir string // Directory containing the mirrors
+}
+
+// DefaultCacheDir returns the directory of the cache, which is BULK_CACHE_DIR
+// if set or a directory within the user cache directory otherwise.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv("BULK_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("get user cache dir: %w", err)
+	}
+	return filepath.Join(dir, "bulk"), nil
+}
+
+// NewCache returns the cache in the directory, which is created if it does
+// not exist.
+func NewCache(dir string) (*Cache, error) {
+	dir = filepath.Join(dir, "mirrors")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// mirrorPath returns the path of the mirror of the remote, which is named
+// after the remote and a hash of it to be unique.
+func (c *Cache) mirrorPath(remote string) string {
+	name := remote
+	if i := strings.LastIndexAny(name, ":/"); i >= 0 {
+		if j := strings.LastIndexAny(name[:i], ":/"); j >= 0 {
+			name = name[j+1:]
+		}
+	}
+	name = strings.Trim(unsafeSlugChars.ReplaceAllString(strings.TrimSuffix(name, cacheMirrorSuffix), "-"), ".-")
+	sum := sha256.Sum256([]byte(remote))
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%s%s", name, hex.EncodeToString(sum[:4]), cacheMirrorSuffix))
+}
+
+// Mirror updates the mirror of the remote with its default branch, which is
+// created if it does not exist, and returns its path. Mirrors are locked
+// while they are updated, so that concurrent runs do not corrupt them. The
+// mirror is in use and kept until the returned function is called.
+func (c *Cache) Mirror(remote string) (string, func() error, error) {
+	path := c.mirrorPath(remote)
+	unlock, err := lockFile(path+cacheUpdateLockSuffix, false)
+	if err != nil {
+		return "", nil, fmt.Errorf("lock mirror: %w", err)
+	}
+	defer unlock()
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		// NOTE: Mirrors are initialised in a temporary directory first, so
+		// that a failed initialisation is not mistaken for a mirror
+		tmp, err := os.MkdirTemp(c.dir, ".init-")
+		if err != nil {
+			return "", nil, fmt.Errorf("create temp dir: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		for _, args := range [][]string{
+			{"init", "--quiet", "--bare", "."},
+			{"remote", "add", "origin", remote},
+			// NOTE: Objects borrowed by worktrees must never be collected
+			// while they may be in use, so collection is left to gc
+			{"config", "gc.auto", "0"},
+		} {
+			if err := gitIn(tmp, args...); err != nil {
+				return "", nil, fmt.Errorf("init mirror: %w", err)
+			}
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return "", nil, fmt.Errorf("move mirror: %w", err)
+		}
+	} else if err != nil {
+		return "", nil, fmt.Errorf("stat mirror: %w", err)
+	}
+	if err := gitIn(path, "fetch", "--quiet", "--no-tags", "origin", "+HEAD:"+cacheHeadRef); err != nil {
+		return "", nil, fmt.Errorf("fetch mirror: %w", err)
+	}
+
+	if _, err := c.gc(path); err != nil {
+		return "", nil, fmt.Errorf("gc mirror: %w", err)
+	}
+
+	// NOTE: The modification time tracks when the mirror was last used
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return "", nil, fmt.Errorf("touch mirror: %w", err)
+	}
+	release, err := lockFile(path+cacheUseLockSuffix, true)
+	if err != nil {
+		return "", nil, fmt.Errorf("lock mirror for use: %w", err)
+	}
+	return path, release, nil
+}
+
+// gc collects the garbage of the mirror if it is not in use, and reports
+// whether it was collected. The update lock must be held.
+func (c *Cache) gc(path string) (bool, error) {
+	unlock, ok, err := tryLockFile(path + cacheUseLockSuffix)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer unlock()
+	if err := gitIn(path, "-c", "gc.auto="+cacheGCAuto, "gc", "--auto", "--quiet"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Prune removes the mirrors that have not been used since the time, and
+// returns their paths. Mirrors in use by other runs are skipped, and the
+// garbage of the mirrors that are kept is collected.
+func (c *Cache) Prune(before time.Time) ([]string, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read cache dir: %w", err)
+	}
+	var pruned []string
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasSuffix(e.Name(), cacheMirrorSuffix) {
+			continue
+		}
+		path := filepath.Join(c.dir, e.Name())
+		removed, err := c.pruneMirror(path, before)
+		if err != nil {
+			return pruned, fmt.Errorf("prune %s: %w", e.Name(), err)
+		}
+		if removed {
+			pruned = append(pruned, path)
+		}
+	}
+	return pruned, nil
+}
+
+// pruneMirror removes the mirror if it has not been used since the time and
+// is not in use, or collects its garbage otherwise.
+func (c *Cache) pruneMirror(path string, before time.Time) (bool, error) {
+	unlock, err := lockFile(path+cacheUpdateLockSuffix, false)
+	if err != nil {
+		return false, fmt.Errorf("lock mirror: %w", err)
+	}
+	defer unlock()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("stat mirror: %w", err)
+	}
+	if !fi.ModTime().Before(before) {
+		if _, err := c.gc(path); err != nil {
+			return false, fmt.Errorf("gc mirror: %w", err)
+		}
+		return false, nil
+	}
+	release, ok, err := tryLockFile(path + cacheUseLockSuffix)
+	if err != nil {
+		return false, fmt.Errorf("lock mirror for use: %w", err)
+	}
+	if !ok {
+		return false, nil
+	}
+	defer release()
+	// NOTE: The lock files are left in place, as concurrent runs may be
+	// waiting on them
+	if err := os.RemoveAll(path); err != nil {
+		return false, fmt.Errorf("remove mirror: %w", err)
+	}
+	return true, nil
+}
+
+// gitIn runs git in the directory.
+func gitIn(dir string, args ...string) error {
+	var stderr bytes.Buffer
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("run git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
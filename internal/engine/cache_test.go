@@ -0,0 +1,120 @@
+//go:build integration && unix
+
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRemote returns a local repository with a commit on its default branch,
+// and the hash of the commit.
+func testRemote(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		c := exec.Command("git", args...)
+		c.Dir = dir
+		c.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+		o, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("failed to run git %v: %v: %s", args, err, o)
+		}
+		return strings.TrimSpace(string(o))
+	}
+	git("init", "--quiet", ".")
+	git("commit", "--quiet", "--allow-empty", "--message", "initial")
+	return dir, git("rev-parse", "HEAD")
+}
+
+func TestCacheMirror(t *testing.T) {
+	remote, head := testRemote(t)
+	c, err := NewCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// NOTE: Concurrent runs must wait for each other to update the mirror
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var release func() error
+			if _, release, errs[i] = c.Mirror(remote); errs[i] == nil {
+				errs[i] = release()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("failed to update mirror: %v", err)
+		}
+	}
+
+	r, err := NewRepository("test", "bulk/test", remote, ".", true, c, nil)
+	if err != nil {
+		t.Fatalf("failed to create repo: %v", err)
+	}
+	defer r.Close()
+	if err := r.fetchHead(); err != nil {
+		t.Fatalf("failed to fetch head: %v", err)
+	}
+	got, err := r.Run("git", "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		t.Fatalf("failed to resolve head: %v", err)
+	}
+	if strings.TrimSpace(got) != head {
+		t.Errorf("unexpected head: got %s, want %s", got, head)
+	}
+	if packs, _ := filepath.Glob(filepath.Join(r.dir, ".git", "objects", "pack", "*.pack")); len(packs) > 0 {
+		t.Errorf("objects are copied instead of borrowed: %v", packs)
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	remote, _ := testRemote(t)
+	c, err := NewCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	path, release, err := c.Mirror(remote)
+	if err != nil {
+		t.Fatalf("failed to update mirror: %v", err)
+	}
+
+	// NOTE: Mirrors in use must not be removed, even when they are old
+	pruned, err := c.Prune(time.Now().Add(time.Second))
+	if err != nil || len(pruned) != 0 {
+		t.Fatalf("unexpected prune of mirror in use: %v, %v", pruned, err)
+	}
+	if collected, err := c.gc(path); err != nil || collected {
+		t.Fatalf("unexpected gc of mirror in use: %v, %v", collected, err)
+	}
+	if err := release(); err != nil {
+		t.Fatalf("failed to release mirror: %v", err)
+	}
+	if collected, err := c.gc(path); err != nil || !collected {
+		t.Fatalf("unexpected gc: %v, %v", collected, err)
+	}
+
+	pruned, err = c.Prune(time.Now().Add(-time.Hour))
+	if err != nil || len(pruned) != 0 {
+		t.Fatalf("unexpected prune of recent mirror: %v, %v", pruned, err)
+	}
+	pruned, err = c.Prune(time.Now().Add(time.Second))
+	if err != nil || len(pruned) != 1 || pruned[0] != path {
+		t.Fatalf("unexpected prune: %v, %v", pruned, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("mirror is not removed: %v", err)
+	}
+}
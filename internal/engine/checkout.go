@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// NOTE: Ignore and attribute files are always checked out, as they affect
+// which files are staged and how.
+var checkoutSparseDefaults = []string{".gitignore", ".gitattributes"}
+
+// Checkout details which files of the repositories are checked out. Sparse
+// checkouts only fetch the blobs of the files that they check out, with a
+// blobless partial clone, and fall back to fetching every blob on servers
+// that do not support filters. Mirrors of the cache hold every blob, as they
+// are shared by plans checking out different files, so sparse checkouts only
+// save on the files written to the worktree when the cache is used.
+type Checkout struct {
+	// Patterns of the files to check out, in the format of .gitignore files.
+	// Patterns starting with / are relative to the repository root. Every
+	// file is checked out if neither this nor sparseTargets is specified.
+	Sparse []string `json:"sparse,omitempty"`
+	// Whether the files targeted by the steps and conditions are checked
+	// out, in addition to the sparse patterns. Steps without targets, such
+	// as scripts, only see the files checked out by other patterns.
+	SparseTargets bool `json:"sparseTargets,omitempty"`
+}
+
+// IsSparse reports whether only some of the files are checked out.
+func (c Checkout) IsSparse() bool {
+	return len(c.Sparse) > 0 || c.SparseTargets
+}
+
+func (c Checkout) Validate() error {
+	for i, p := range c.Sparse {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("sparse.%d must not be empty", i)
+		}
+		if strings.ContainsAny(p, "\r\n") {
+			return fmt.Errorf("sparse.%d must be a single line", i)
+		}
+	}
+	return nil
+}
+
+// targeter is implemented by operators that only read and write the files
+// matching their targets.
+type targeter interface {
+	// targets returns the glob patterns of the files, relative to the
+	// working directory of the step.
+	targets() []string
+}
+
+// errNoTargets is reported for steps whose files cannot be derived for sparse
+// checkouts.
+var errNoTargets = errors.New("step has no targets, so the files that it needs must be listed in checkout.sparse")
+
+// sparsePatterns returns the patterns of the sparse checkout of the plan, or
+// nil if every file is checked out.
+func (p *Plan) sparsePatterns() []string {
+	if !p.Checkout.IsSparse() {
+		return nil
+	}
+	patterns := slices.Clone(checkoutSparseDefaults)
+	if p.Checkout.SparseTargets {
+		for _, c := range p.On.Where {
+			patterns = appendSparsePatterns(patterns, "", c.targets())
+		}
+		for _, s := range p.Steps {
+			if s.If != nil {
+				patterns = appendSparsePatterns(patterns, s.WorkingDirectory, s.If.targets())
+			}
+			if t, ok := s.Operator.(targeter); ok {
+				patterns = appendSparsePatterns(patterns, s.WorkingDirectory, t.targets())
+			}
+		}
+	}
+	// NOTE: Patterns of the plan come last, so that its exclusions apply to
+	// the derived patterns
+	patterns = append(patterns, p.Checkout.Sparse...)
+
+	seen := make(map[string]struct{}, len(patterns))
+	return slices.DeleteFunc(patterns, func(p string) bool {
+		if _, ok := seen[p]; ok {
+			return true
+		}
+		seen[p] = struct{}{}
+		return false
+	})
+}
+
+// appendSparsePatterns appends the sparse checkout patterns matching the
+// globs relative to the working directory. Exclusions are skipped, as
+// checking out more files than needed is harmless.
+func appendSparsePatterns(patterns []string, wd string, globs []string) []string {
+	for _, g := range globs {
+		if g == "" || strings.HasPrefix(g, globExcludePrefix) {
+			continue
+		}
+		p := path.Join("/", wd, g)
+		// NOTE: Braces are not supported by .gitignore patterns, so the
+		// directory before the first wildcard is checked out instead
+		if strings.Contains(p, "{") {
+			prefix := p[:strings.IndexAny(p, "*?[{")]
+			p = prefix[:strings.LastIndex(prefix, "/")+1]
+			if p == "/" {
+				p = "/*"
+			}
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// targets returns the paths that the condition reads. Commands are not
+// included as the paths that they read are unknown.
+func (c *Condition) targets() []string {
+	var paths []string
+	if c.Exists != "" {
+		paths = append(paths, c.Exists)
+	}
+	if c.Matches != "" {
+		paths = append(paths, c.Matches)
+	}
+	if c.Contains != nil {
+		paths = append(paths, c.Contains.Path)
+	}
+	return paths
+}
@@ -0,0 +1,90 @@
+//go:build integration && unix
+
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSparseCheckout(t *testing.T) {
+	const doc = `version: 0
+id: test
+on:
+  repositories: [owner/repo]
+checkout:
+  sparseTargets: true
+steps:
+  - editor:
+      target: [a/*.md]
+      replacements: [{search: old, replace: new}]
+  - file:
+      action: copy
+      target: [a/x.md]
+      destination: b/new.md
+commit:
+  title: t
+  body: b
+  author: {name: t, email: t@example.com}
+`
+	for name, filter := range map[string]bool{"filter": true, "no filter": false} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+			dir := t.TempDir()
+			git := func(dir string, args ...string) string {
+				t.Helper()
+				c := exec.Command("git", args...)
+				c.Dir = dir
+				c.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+				o, err := c.CombinedOutput()
+				if err != nil {
+					t.Fatalf("failed to run git %v: %v: %s", args, err, o)
+				}
+				return strings.TrimSpace(string(o))
+			}
+			for name, content := range map[string]string{"a/x.md": "old\n", "b/y.txt": "y\n", "c.txt": "c\n"} {
+				p := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatalf("failed to create dir: %v", err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write file: %v", err)
+				}
+			}
+			git(dir, "init", "--quiet", ".")
+			git(dir, "config", "uploadpack.allowFilter", strconv.FormatBool(filter))
+			git(dir, "add", ".")
+			git(dir, "commit", "--quiet", "--message", "initial")
+			// NOTE: Local paths bypass the transport that supports filters
+			remote := "file://" + dir
+
+			p, err := NewPlanFromYAML(strings.NewReader(doc))
+			if err != nil {
+				t.Fatalf("failed to decode plan: %v", err)
+			}
+			r, err := NewRepository("test", "bulk/test", remote, ".", true, nil, p.sparsePatterns())
+			if err != nil {
+				t.Fatalf("failed to create repo: %v", err)
+			}
+			defer r.Close()
+			if err := r.ApplyAndPushChanges(TemplateContext{Plan: *p}, p.Commit, p.Steps...); err != nil {
+				t.Fatalf("failed to apply changes: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(r.dir, "b", "y.txt")); !os.IsNotExist(err) {
+				t.Errorf("file outside of sparse checkout is checked out: %v", err)
+			}
+			missing := git(r.dir, "rev-list", "--objects", "--missing=print", "HEAD")
+			if got := strings.Count(missing, "\n?"); got != map[bool]int{true: 2, false: 0}[filter] {
+				t.Errorf("unexpected number of missing blobs: got %d\n%s", got, missing)
+			}
+			if got := git(dir, "show", "bulk/test:b/new.md"); got != "new" {
+				t.Errorf("unexpected pushed file: got %q", got)
+			}
+		})
+	}
+}
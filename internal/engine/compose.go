@@ -0,0 +1,266 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// NOTE: Plans are composed on their decoded values before they are validated,
+// as base plans and step fragments are usually incomplete on their own.
+
+const (
+	extendsKey = "extends"
+	includeKey = "include"
+)
+
+// ComposeError is an error in resolving a reference to another file.
+type ComposeError struct {
+	Path string // Dot-separated path to the reference, e.g. steps.0
+	Err  error
+}
+
+func (e *ComposeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *ComposeError) Unwrap() error {
+	return e.Err
+}
+
+// isComposed reports whether the plan value extends a base plan or includes
+// step fragments.
+func isComposed(v any) bool {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+	if _, ok := m[extendsKey]; ok {
+		return true
+	}
+	steps, _ := m["steps"].([]any)
+	return slices.ContainsFunc(steps, isInclude)
+}
+
+// isInclude reports whether the step value includes a step fragment.
+func isInclude(v any) bool {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = m[includeKey]
+	return ok
+}
+
+// planComposer resolves the references of plans to other files.
+type planComposer struct {
+	stack []string // Absolute paths of the files being resolved
+}
+
+// composePlan returns the plan value with its step fragments included and its
+// base plan merged in. References are resolved relative to dir.
+func (c *planComposer) composePlan(v any, dir string) (any, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		// NOTE: Left to the schema to report
+		return v, nil
+	}
+	m = maps.Clone(m)
+	if steps, ok := m["steps"].([]any); ok {
+		resolved, err := c.includeSteps(steps, dir)
+		if err != nil {
+			return nil, err
+		}
+		m["steps"] = resolved
+	}
+	ref, ok := m[extendsKey]
+	if !ok {
+		return m, nil
+	}
+	delete(m, extendsKey)
+	name, err := resolveReference(dir, ref)
+	if err != nil {
+		return nil, &ComposeError{Path: extendsKey, Err: err}
+	}
+	base, err := c.load(name, func(v any) (any, error) {
+		if _, ok := v.(map[string]any); !ok {
+			return nil, errors.New("base plan must be an object")
+		}
+		return c.composePlan(v, filepath.Dir(name))
+	})
+	if err != nil {
+		return nil, &ComposeError{Path: extendsKey, Err: fmt.Errorf("extend %s: %w", ref, err)}
+	}
+	return mergeValues(base, m), nil
+}
+
+// includeSteps returns the steps with the includes replaced by the steps of
+// their fragments. References are resolved relative to dir.
+func (c *planComposer) includeSteps(steps []any, dir string) ([]any, error) {
+	resolved := make([]any, 0, len(steps))
+	for i, step := range steps {
+		if !isInclude(step) {
+			resolved = append(resolved, step)
+			continue
+		}
+		path := fmt.Sprintf("steps.%d", i)
+		m := step.(map[string]any)
+		if len(m) > 1 {
+			return nil, &ComposeError{Path: path, Err: errors.New("include cannot be combined with other fields")}
+		}
+		ref := m[includeKey]
+		name, err := resolveReference(dir, ref)
+		if err != nil {
+			return nil, &ComposeError{Path: path, Err: err}
+		}
+		fragment, err := c.load(name, func(v any) (any, error) {
+			steps, ok := v.([]any)
+			if !ok {
+				return nil, errors.New("fragment must be a list of steps")
+			}
+			return c.includeSteps(steps, filepath.Dir(name))
+		})
+		if err != nil {
+			return nil, &ComposeError{Path: path, Err: fmt.Errorf("include %s: %w", ref, err)}
+		}
+		resolved = append(resolved, fragment.([]any)...)
+	}
+	return resolved, nil
+}
+
+// load decodes the referenced file and resolves its own references, failing
+// if the file is already being resolved.
+func (c *planComposer) load(name string, resolve func(v any) (any, error)) (any, error) {
+	if i := slices.Index(c.stack, name); i >= 0 {
+		return nil, fmt.Errorf("cycle detected: %s", strings.Join(slices.Concat(c.stack[i:], []string{name}), " -> "))
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	v, err := decodeValue(name, b)
+	if err != nil {
+		return nil, err
+	}
+	c.stack = append(c.stack, name)
+	defer func() { c.stack = c.stack[:len(c.stack)-1] }()
+	return resolve(v)
+}
+
+// decodeValue decodes the single document in the JSON or YAML file, which is
+// migrated to the latest version if it is a plan.
+func decodeValue(name string, b []byte) (any, error) {
+	format := planFormat(name, b)
+	var v any
+	var doc ast.Node
+	switch format {
+	case planFormatJSON:
+		var err error
+		if v, err = jsonschema.UnmarshalJSON(bytes.NewReader(b)); err != nil {
+			return nil, fmt.Errorf("decode json: %w", err)
+		}
+		if file, err := parser.ParseBytes(b, 0); err == nil && len(file.Docs) > 0 {
+			doc = file.Docs[0].Body
+		}
+	default:
+		file, err := parser.ParseBytes(b, 0)
+		if err != nil {
+			return nil, fmt.Errorf("parse yaml: %w", err)
+		}
+		docs := yamlDocuments(file)
+		if len(docs) != 1 {
+			return nil, fmt.Errorf("expected a single document but found %d", len(docs))
+		}
+		doc = docs[0]
+		if v, err = yamlNodeToJSON(doc); err != nil {
+			return nil, fmt.Errorf("convert yaml: %w", err)
+		}
+	}
+	v, err := migratePlanValue(v, doc)
+	if err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", format, err)
+	}
+	return v, nil
+}
+
+// resolveReference returns the absolute path of the file referenced relative
+// to dir.
+func resolveReference(dir string, ref any) (string, error) {
+	s, ok := ref.(string)
+	if !ok || s == "" {
+		return "", errors.New("reference must be a non-empty path")
+	}
+	if strings.Contains(s, "://") {
+		return "", fmt.Errorf("reference %s must be a local path", s)
+	}
+	if filepath.IsAbs(s) {
+		return "", fmt.Errorf("reference %s must be relative", s)
+	}
+	return filepath.Abs(filepath.Join(dir, filepath.FromSlash(s)))
+}
+
+// mergeValues returns the child value merged onto the base value. Objects are
+// merged by key, where a null value removes the key, and arrays are appended
+// to the base. Any other value replaces the base.
+func mergeValues(base, child any) any {
+	switch c := child.(type) {
+	case map[string]any:
+		b, ok := base.(map[string]any)
+		if !ok {
+			return stripNulls(c)
+		}
+		m := maps.Clone(b)
+		for k, v := range c {
+			if v == nil {
+				delete(m, k)
+				continue
+			}
+			if bv, ok := m[k]; ok {
+				m[k] = mergeValues(bv, v)
+				continue
+			}
+			m[k] = stripNulls(v)
+		}
+		return m
+	case []any:
+		b, ok := base.([]any)
+		if !ok {
+			return stripNulls(c)
+		}
+		return slices.Concat(b, stripNulls(c).([]any))
+	}
+	return child
+}
+
+// stripNulls returns the value without the keys of null values in objects,
+// as the keys removed by a child that are not in the base would otherwise be
+// kept as nulls.
+func stripNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			if e != nil {
+				m[k] = stripNulls(e)
+			}
+		}
+		return m
+	case []any:
+		// NOTE: Null elements are kept since they do not remove anything
+		a := make([]any, len(v))
+		for i, e := range v {
+			a[i] = stripNulls(e)
+		}
+		return a
+	}
+	return v
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeValues(t *testing.T) {
+	base := map[string]any{
+		"id":    "base",
+		"on":    map[string]any{"repositories": []any{"owner/a"}, "where": []any{"x"}},
+		"steps": []any{"setup"},
+	}
+	child := map[string]any{
+		"id":    "child",
+		"on":    map[string]any{"repositories": []any{"owner/b"}, "where": nil},
+		"steps": []any{"run"},
+	}
+	want := map[string]any{
+		"id":    "child",
+		"on":    map[string]any{"repositories": []any{"owner/a", "owner/b"}},
+		"steps": []any{"setup", "run"},
+	}
+	if got := mergeValues(base, child); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected merge: got %v, want %v", got, want)
+	}
+
+	// NOTE: Nulls under keys that are not in the base have nothing to remove
+	child = map[string]any{
+		"commit": map[string]any{"title": "t", "author": nil},
+		"on":     "push",
+		"steps":  []any{map[string]any{"run": "x", "timeout": nil}},
+	}
+	base = map[string]any{"on": map[string]any{"where": nil}, "steps": []any{}}
+	want = map[string]any{
+		"commit": map[string]any{"title": "t"},
+		"on":     "push",
+		"steps":  []any{map[string]any{"run": "x"}},
+	}
+	if got := mergeValues(base, child); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected merge of nested nulls: got %v, want %v", got, want)
+	}
+}
+
+func TestNewPlansFromFileComposed(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"shared/base.yml":  "version: 0\non:\n  repositories: [owner/a]\nsteps:\n  - include: setup.yml\ncommit: {title: t, body: b}\n",
+		"shared/setup.yml": "- script:\n    run: npm ci\n",
+		"plans/plan.yml":   "extends: ../shared/base.yml\nid: test\nsteps:\n  - script:\n      run: npx prettier --write .\n",
+		"plans/cycle.yml":  "extends: cycle.yml\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	plans, err := NewPlansFromFile(filepath.Join(dir, "plans/plan.yml"))
+	if err != nil {
+		t.Fatalf("failed to decode plan: %v", err)
+	}
+	p := plans[0]
+	if p.ID != "test" || p.Commit.Title != "t" || len(p.Steps) != 2 {
+		t.Fatalf("unexpected plan: %+v", p)
+	}
+	if run := p.Steps[0].Operator.(*OperatorExecScript).Run; run != "npm ci" {
+		t.Errorf("unexpected first step: %s", run)
+	}
+
+	_, err = NewPlansFromFile(filepath.Join(dir, "plans/cycle.yml"))
+	if err == nil || !strings.Contains(err.Error(), "cycle detected") {
+		t.Fatalf("unexpected error: got %v, want cycle", err)
+	}
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Condition is a set of predicates evaluated against the worktree of a
+// repository. All specified predicates must hold for it to be satisfied.
+type Condition struct {
+	// Path that must exist in the repository.
+	Exists string `json:"exists,omitempty"`
+	// Glob expression that must match at least one path.
+	Matches string `json:"matches,omitempty"`
+	// File whose contents must match a regular expression.
+	Contains *ConditionContains `json:"contains,omitempty"`
+	// Template expression over the repository context that must render to
+	// true.
+	Expr string `json:"expr,omitempty"`
+	// Check command that must exit with code 0.
+	Run string `json:"run,omitempty"`
+	// Shell used to run the check command, as the shell of a script step.
+	Shell string `json:"shell,omitempty"`
+}
+
+type ConditionContains struct {
+	// Path of the file to read.
+	Path string `json:"path"`
+	// Regular expression to match against the file contents.
+	Pattern string `json:"pattern"`
+}
+
+// NOTE: At least one predicate must be specified
+func (*Condition) extendSchema(g *schemaGenerator, s *jsonSchema) {
+	n := 1
+	s.MinProperties = &n
+	extendShellSchema(s.Properties.get("shell"))
+}
+
+func (c *Condition) Validate() error {
+	if c.Exists == "" && c.Matches == "" && c.Contains == nil && c.Expr == "" && c.Run == "" {
+		return fmt.Errorf("no predicate specified")
+	}
+	if c.Exists != "" {
+		if err := validateRelativePath(c.Exists); err != nil {
+			return fmt.Errorf("exists is not valid: %w", err)
+		}
+	}
+	if c.Matches != "" {
+		if err := validateGlobs([]string{c.Matches}); err != nil {
+			return fmt.Errorf("matches is not valid: %w", err)
+		}
+	}
+	if c.Contains != nil {
+		if c.Contains.Path == "" {
+			return fmt.Errorf("contains.path is not specified")
+		}
+		if err := validateRelativePath(c.Contains.Path); err != nil {
+			return fmt.Errorf("contains.path is not valid: %w", err)
+		}
+		if _, err := regexp.Compile(c.Contains.Pattern); err != nil {
+			return fmt.Errorf("contains.pattern is not a valid regex: %w", err)
+		}
+	}
+	if c.Expr != "" {
+		if _, err := template.New("expr").Parse(c.Expr); err != nil {
+			return fmt.Errorf("expr is not a valid template: %w", err)
+		}
+	}
+	if c.Shell != "" {
+		if c.Run == "" {
+			return fmt.Errorf("shell is only supported with run")
+		}
+		if _, err := c.script().shell(); err != nil {
+			return fmt.Errorf("shell is not valid: %w", err)
+		}
+	}
+	return nil
+}
+
+// script returns the script that runs the check command.
+func (c *Condition) script() *OperatorExecScript {
+	return &OperatorExecScript{Run: c.Run, Shell: c.Shell}
+}
+
+// Evaluate reports whether the condition holds. When it does not, the reason
+// describes the first predicate that failed.
+func (c *Condition) Evaluate(ctx OperatorContext) (ok bool, reason string, err error) {
+	root := ctx.workPath()
+	if c.Exists != "" {
+		p, err := resolvePath(root, c.Exists)
+		if err != nil {
+			return false, "", fmt.Errorf("resolve exists: %w", err)
+		}
+		if _, err := os.Stat(p); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, fmt.Sprintf("%s does not exist", c.Exists), nil
+			}
+			return false, "", fmt.Errorf("stat %s: %w", c.Exists, err)
+		}
+	}
+	if c.Matches != "" {
+		m, err := globPaths(root, []string{c.Matches})
+		if err != nil {
+			return false, "", fmt.Errorf("resolve matches: %w", err)
+		}
+		if len(m) == 0 {
+			return false, fmt.Sprintf("no files match %s", c.Matches), nil
+		}
+	}
+	if c.Contains != nil {
+		p, err := resolvePath(root, c.Contains.Path)
+		if err != nil {
+			return false, "", fmt.Errorf("resolve contains.path: %w", err)
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			// NOTE: Patterns matching empty content must not hold for
+			// missing files
+			if errors.Is(err, os.ErrNotExist) {
+				return false, fmt.Sprintf("%s does not exist", c.Contains.Path), nil
+			}
+			return false, "", fmt.Errorf("read file %s: %w", c.Contains.Path, err)
+		}
+		re, err := regexp.Compile(c.Contains.Pattern)
+		if err != nil {
+			return false, "", fmt.Errorf("compile regex: %w", err)
+		}
+		if !re.Match(b) {
+			return false, fmt.Sprintf("%s does not contain %s", c.Contains.Path, c.Contains.Pattern), nil
+		}
+	}
+	if c.Expr != "" {
+		s, err := ctx.Template.RenderString(c.Expr)
+		if err != nil {
+			return false, "", fmt.Errorf("render expr: %w", err)
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return false, "", fmt.Errorf("expr must evaluate to a boolean: %w", err)
+		}
+		if !v {
+			return false, fmt.Sprintf("%s is false", c.Expr), nil
+		}
+	}
+	if c.Run != "" {
+		if err := c.script().Apply(ctx); err != nil {
+			// NOTE: Commands killed by the timeout of the step must fail it
+			// instead of skipping it
+			var e *exec.ExitError
+			if errors.As(err, &e) && ctx.context().Err() == nil {
+				return false, fmt.Sprintf("%q exited with code %d", c.Run, e.ExitCode()), nil
+			}
+			return false, "", fmt.Errorf("run check: %w", err)
+		}
+	}
+	return true, "", nil
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditionEvaluateContains(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n\ngo 1.22\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	cases := []struct {
+		name     string
+		contains ConditionContains
+		want     bool
+	}{
+		{"match", ConditionContains{Path: "go.mod", Pattern: `(?m)^go 1\.22$`}, true},
+		{"no match", ConditionContains{Path: "go.mod", Pattern: `(?m)^go 1\.23$`}, false},
+		{"missing file", ConditionContains{Path: "missing", Pattern: `.*`}, false},
+		{"missing file with empty pattern", ConditionContains{Path: "missing", Pattern: `^$`}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Condition{Contains: &tc.contains}
+			got, reason, err := c.Evaluate(OperatorContext{Dir: dir})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("unexpected result: got %v (%s), want %v", got, reason, tc.want)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluateRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	cases := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"success", Condition{Run: "true", Shell: "sh"}, true},
+		{"failure", Condition{Run: "exit 3", Shell: "sh"}, false},
+		{"custom shell", Condition{Run: "test \"$0\" = x", Shell: "sh -c '. \"$1\"' x {0}"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.cond.Validate(); err != nil {
+				t.Fatalf("invalid condition: %v", err)
+			}
+			got, reason, err := tc.cond.Evaluate(OperatorContext{Dir: t.TempDir()})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("unexpected result: got %v (%s), want %v", got, reason, tc.want)
+			}
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		c := Condition{Run: "sleep 5", Shell: "sh"}
+		if _, _, err := c.Evaluate(OperatorContext{Context: ctx, Dir: t.TempDir()}); err == nil || !strings.Contains(err.Error(), "run check") {
+			t.Errorf("expected error for killed check: %v", err)
+		}
+	})
+}
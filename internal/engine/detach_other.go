@@ -0,0 +1,9 @@
+//go:build !unix
+
+package engine
+
+import "os/exec"
+
+// detachTerminal is a no-op where commands cannot be detached from the
+// terminal, as stdin is already not connected to it.
+func detachTerminal(c *exec.Cmd) {}
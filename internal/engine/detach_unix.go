@@ -0,0 +1,14 @@
+//go:build unix
+
+package engine
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachTerminal starts the command in a new session without a controlling
+// terminal, so that it cannot prompt on /dev/tty.
+func detachTerminal(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
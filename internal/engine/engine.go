@@ -6,24 +6,101 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
 type Engine struct {
-	p     *Plan
-	force bool
+	p      *Plan
+	dir    string // Directory containing the plan file
+	force  bool
+	noSign bool   // Whether commit signing is disabled
+	cache  *Cache // Cache of mirrors, if any
 }
 
 func (e *Engine) SetForce(force bool) {
 	e.force = force
 }
 
-func (e *Engine) SetKey(key string) {
+// SetCache sets the cache of mirrors that repositories are fetched through.
+func (e *Engine) SetCache(c *Cache) {
+	e.cache = c
+}
+
+// SetNoSign disables the signing of commits, regardless of the plan and the
+// Git configuration.
+func (e *Engine) SetNoSign(noSign bool) {
+	e.noSign = noSign
+}
+
+func (e *Engine) SetKey(key string) error {
 	// Override the plan ID if a non-empty key is provided
 	k := strings.TrimSpace(key)
-	if k != "" {
-		e.p.ID = k
+	if k == "" {
+		return nil
+	}
+	if err := validatePlanID(k); err != nil {
+		return err
+	}
+	e.p.ID = k
+	e.p.derivedID = false
+	return nil
+}
+
+// SetBranch overrides the branch template of the plan if it is non-empty.
+func (e *Engine) SetBranch(branch string) error {
+	if branch == "" {
+		return nil
+	}
+	if err := checkTemplate(branch); err != nil {
+		return err
+	}
+	e.p.Commit.Branch = branch
+	return nil
+}
+
+// SetAuthor overrides the commit author of the plan if it is non-empty, which
+// is of the form `Name <email>`.
+func (e *Engine) SetAuthor(author string) error {
+	if author == "" {
+		return nil
+	}
+	id, err := ParseCommitIdentity(author)
+	if err != nil {
+		return err
+	}
+	e.p.Commit.Author = id
+	return nil
+}
+
+// SetCommitter overrides the commit committer of the plan if it is
+// non-empty, which is of the form `Name <email>`.
+func (e *Engine) SetCommitter(committer string) error {
+	if committer == "" {
+		return nil
+	}
+	id, err := ParseCommitIdentity(committer)
+	if err != nil {
+		return err
+	}
+	e.p.Commit.Committer = id
+	return nil
+}
+
+// AddTrailers adds commit trailers of the form `Key: value` to those of the
+// plan, whose values are rendered as templates.
+func (e *Engine) AddTrailers(trailers ...string) error {
+	for _, s := range trailers {
+		t, err := ParseCommitTrailer(s)
+		if err != nil {
+			return err
+		}
+		if err := checkTemplate(t.Value); err != nil {
+			return fmt.Errorf("trailer %s: %w", t.Key, err)
+		}
+		e.p.Commit.Trailers = append(e.p.Commit.Trailers, t)
 	}
+	return nil
 }
 
 func (e *Engine) Execute() error {
@@ -32,21 +109,47 @@ func (e *Engine) Execute() error {
 		return fmt.Errorf("get repositories: %w", err)
 	}
 
+	if err := checkSigning(e.p.Commit, e.noSign); err != nil {
+		return fmt.Errorf("check signing: %w", err)
+	}
+	if e.p.derivedID {
+		fmt.Printf("Using id %s derived from the plan\n", e.p.ID)
+	}
 	for _, repo := range repos {
 		fmt.Printf("Processing %s...\n", repo)
 
+		tc := TemplateContext{
+			Plan:       *e.p,
+			Repository: NewRepositoryContext(repo),
+		}
+		commit, err := e.p.Commit.forRepository(tc)
+		if err != nil {
+			return fmt.Errorf("render commit for %s: %w", repo, err)
+		}
+		steps, err := stepsForRepository(e.p.Steps, tc)
+		if err != nil {
+			return fmt.Errorf("render steps for %s: %w", repo, err)
+		}
+
 		remote := fmt.Sprintf("git@github.com:%s.git", repo)
-		r, err := NewRepository(e.p.ID, remote, e.force)
+		r, err := NewRepository(e.p.ID, commit.Branch, remote, e.dir, e.force, e.cache, e.p.sparsePatterns())
 		if err != nil {
 			return fmt.Errorf("new repo: %w", err)
 		}
 		defer r.Close() // TODO: Handle error?
+		if err := r.Configure(signingConfig(commit, e.noSign)); err != nil {
+			return fmt.Errorf("configure repo: %w", err)
+		}
 
-		if err := r.ApplyAndPushChanges(e.p.Commit.Title, e.p.Commit.Body, e.p.Steps...); err != nil {
-			return fmt.Errorf("apply and push changes: %w", err)
+		if err := r.ApplyAndPushChanges(tc, commit, steps...); err != nil {
+			if errors.Is(err, ErrNotApplicable) || errors.Is(err, ErrFilteredOut) {
+				fmt.Printf("Skipping %s: %s\n", repo, err)
+				continue
+			}
+			return fmt.Errorf("apply and push changes to %s: %w", repo, err)
 		}
-		if err := r.CreateGitHubPullRequest(e.p.Commit.Title, e.p.Commit.Body); err != nil {
-			return fmt.Errorf("create pr: %w", err)
+		if err := r.CreateGitHubPullRequest(commit.Title, commit.Body); err != nil {
+			return fmt.Errorf("create pr for %s: %w", repo, err)
 		}
 	}
 	return nil
@@ -123,34 +226,61 @@ func (e *Engine) searchRepositories() ([]string, error) {
 }
 
 func New(p *Plan) (*Engine, error) {
-	c := TemplateContext{
-		Plan: *p,
+	if err := p.deriveID(); err != nil {
+		return nil, fmt.Errorf("derive id: %w", err)
 	}
-	if err := p.Inject(c); err != nil {
-		return nil, fmt.Errorf("inject tmpl: %w", err)
-	}
-	for i, step := range p.Steps {
-		op, err := step.GetOperator()
-		if err != nil {
-			return nil, fmt.Errorf("get operator for step %d: %w", i, err)
-		}
-		if err := op.Validate(); err != nil {
-			return nil, fmt.Errorf("validate step %d: %w", i, err)
+	// NOTE: The same checks as `bulk validate` are run, so that plans that
+	// are reported valid can also be applied
+	var warnings []planProblem
+	for _, prob := range p.problems(func(string) bool { return false }) {
+		if prob.severity == SeverityError {
+			return nil, fmt.Errorf("validate plan: %w", prob)
 		}
+		warnings = append(warnings, prob)
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
 	}
-	return &Engine{p: p}, nil
+	return &Engine{p: p, dir: "."}, nil
 }
 
-func NewFromFile(name string) (*Engine, error) {
-	f, err := os.Open(name)
+// NewFromFile returns an engine for each plan in the file, which is read from
+// stdin if the name is -. The plans are expected to be executed in order.
+func NewFromFile(name string) ([]*Engine, error) {
+	plans, err := NewPlansFromFile(name)
 	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
+		return nil, fmt.Errorf("parse plan: %w", err)
 	}
-	defer f.Close()
 
-	p, err := NewPlanFromYAML(f)
+	// NOTE: Files referenced by the plan are resolved relative to it, or the
+	// current directory if it is read from stdin
+	dir := "."
+	if name != "-" {
+		dir = filepath.Dir(name)
+	}
+	dir, err = filepath.Abs(dir)
 	if err != nil {
-		return nil, fmt.Errorf("parse plan: %w", err)
+		return nil, fmt.Errorf("resolve plan dir: %w", err)
+	}
+
+	engines := make([]*Engine, 0, len(plans))
+	ids := make(map[string]int, len(plans))
+	for i, p := range plans {
+		// NOTE: Plans sharing an id would push onto the same branch
+		if j, ok := ids[p.ID]; ok {
+			return nil, fmt.Errorf("plan %d has the same id %s as plan %d", i, p.ID, j)
+		}
+		ids[p.ID] = i
+
+		e, err := New(p)
+		if err != nil {
+			if len(plans) > 1 {
+				return nil, fmt.Errorf("plan %d: %w", i, err)
+			}
+			return nil, err
+		}
+		e.dir = dir
+		engines = append(engines, e)
 	}
-	return New(p)
+	return engines, nil
 }
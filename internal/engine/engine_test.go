@@ -0,0 +1,183 @@
+//go:build integration && unix
+
+package engine
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupTestGitHub redirects the remotes of the repositories on GitHub to local
+// repositories with an initial commit, and records the pull requests with a
+// fake gh. It returns the root of the remotes and the log of gh.
+func setupTestGitHub(t *testing.T, names ...string) (string, string) {
+	t.Helper()
+	root, bin := t.TempDir(), t.TempDir()
+	config := filepath.Join(t.TempDir(), "gitconfig")
+	if err := os.WriteFile(config, []byte("[url \"file://"+root+"/\"]\n\tinsteadOf = git@github.com:\n"), 0644); err != nil {
+		t.Fatalf("failed to write git config: %v", err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", config)
+	log := filepath.Join(t.TempDir(), "gh.log")
+	gh := "#!/bin/sh\necho \"$@\" >> " + log + "\ncase \"$2\" in list) echo 0 ;; esac\n"
+	if err := os.WriteFile(filepath.Join(bin, "gh"), []byte(gh), 0755); err != nil {
+		t.Fatalf("failed to write gh: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, name := range names {
+		dir := filepath.Join(root, "owner", name+".git")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		testGit(t, dir, "init", "--quiet", ".")
+		testGit(t, dir, "commit", "--quiet", "--allow-empty", "--message", "initial")
+	}
+	return root, log
+}
+
+// testGit runs git in the directory with a fixed identity, and returns its
+// output.
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+	o, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run git %v: %v: %s", args, err, o)
+	}
+	return strings.TrimSpace(string(o))
+}
+
+func TestEngineExecuteTemplates(t *testing.T) {
+	const doc = `version: 0
+id: test
+on:
+  repositories: [owner/a, owner/b]
+steps:
+  - script:
+      run: echo "{{ .Repository.Repo }}" > out.txt
+commit:
+  title: "chore: update {{ .Repository.Name }}"
+  body: Updated {{ .Repository.Repo }}.
+  author: {name: t, email: t@example.com}
+`
+	root, log := setupTestGitHub(t, "a", "b")
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		return testGit(t, dir, args...)
+	}
+
+	p, err := NewPlanFromYAML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to decode plan: %v", err)
+	}
+	e, err := New(p)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	e.SetForce(true)
+	e.SetNoSign(true)
+	if err := e.Execute(); err != nil {
+		t.Fatalf("failed to execute: %v", err)
+	}
+
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("failed to read gh log: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(root, "owner", name+".git")
+		if got := git(dir, "show", "bulk/test:out.txt"); got != name {
+			t.Errorf("unexpected step output of %s: got %q", name, got)
+		}
+		if got := git(dir, "log", "-1", "--format=%s%n%b", "bulk/test"); !strings.HasPrefix(got, "chore: update owner/"+name+"\nUpdated "+name+".") {
+			t.Errorf("unexpected commit of %s: got %q", name, got)
+		}
+		if !strings.Contains(string(b), "--title chore: update owner/"+name+" --body Updated "+name+".") {
+			t.Errorf("unexpected pull requests of %s:\n%s", name, b)
+		}
+	}
+}
+
+func TestEngineExecuteWhere(t *testing.T) {
+	const doc = `version: 0
+id: test
+on:
+  repositories: [owner/a, owner/b]
+  where:
+    - exists: go.mod
+steps:
+  - script:
+      run: echo "{{ .Repository.Repo }}" | tee out.txt >> "$BULK_TEST_LOG"
+commit:
+  title: "chore: update"
+  body: Updated.
+  author: {name: t, email: t@example.com}
+`
+	root, log := setupTestGitHub(t, "a", "b")
+	dir := filepath.Join(root, "owner", "a.git")
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module a\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	testGit(t, dir, "add", "go.mod")
+	testGit(t, dir, "commit", "--quiet", "--message", "add go.mod")
+	steps := filepath.Join(t.TempDir(), "steps.log")
+	t.Setenv("BULK_TEST_LOG", steps)
+
+	p, err := NewPlanFromYAML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to decode plan: %v", err)
+	}
+	e, err := New(p)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	e.SetForce(true)
+	e.SetNoSign(true)
+	out := captureStdout(t, func() {
+		if err := e.Execute(); err != nil {
+			t.Errorf("failed to execute: %v", err)
+		}
+	})
+
+	if !strings.Contains(out, "Skipping owner/b: filtered out") {
+		t.Errorf("unexpected output, want owner/b to be skipped:\n%s", out)
+	}
+	b, err := os.ReadFile(steps)
+	if err != nil {
+		t.Fatalf("failed to read steps log: %v", err)
+	}
+	if got := string(b); got != "a\n" {
+		t.Errorf("unexpected repos that steps ran on: got %q, want %q", got, "a\n")
+	}
+	if b, _ := os.ReadFile(log); strings.Contains(string(b), "owner/b") || strings.Count(string(b), "pr create") != 1 {
+		t.Errorf("unexpected pull requests:\n%s", b)
+	}
+}
+
+// captureStdout returns what is written to stdout while running f.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
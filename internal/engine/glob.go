@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// globExcludePrefix marks a pattern as an exclusion.
+const globExcludePrefix = "!"
+
+// validateGlobs checks that the patterns are valid and relative, and that at
+// least one of them is not an exclusion.
+func validateGlobs(patterns []string) error {
+	includes := 0
+	for i, p := range patterns {
+		p, excluded := strings.CutPrefix(p, globExcludePrefix)
+		if !excluded {
+			includes++
+		}
+		if err := validateRelativePath(p); err != nil {
+			return fmt.Errorf("pattern %d is not valid: %w", i, err)
+		}
+		if !doublestar.ValidatePattern(p) {
+			return fmt.Errorf("pattern %d is not a valid glob: %s", i, p)
+		}
+	}
+	if includes == 0 {
+		return fmt.Errorf("no inclusion pattern specified")
+	}
+	return nil
+}
+
+// globPaths returns the sorted paths under root that match any of the
+// patterns, minus those matching a pattern prefixed with `!`. Patterns support
+// `**` to match across directories, and paths within `.git` are never matched.
+func globPaths(root string, patterns []string) ([]string, error) {
+	var includes, excludes []string
+	for _, p := range patterns {
+		e, excluded := strings.CutPrefix(p, globExcludePrefix)
+		e = path.Clean(filepath.ToSlash(e))
+		// NOTE: Patterns escaping the root would otherwise silently match
+		// nothing, as they are not valid paths of the filesystem
+		if e == ".." || strings.HasPrefix(e, "../") || path.IsAbs(e) {
+			return nil, fmt.Errorf("pattern '%s' is outside of root", p)
+		}
+		if excluded {
+			excludes = append(excludes, e)
+			continue
+		}
+		includes = append(includes, e)
+	}
+
+	fsys := os.DirFS(root)
+	seen := make(map[string]struct{})
+	for _, p := range includes {
+		// NOTE: Symlinked dirs are not traversed so that `**` cannot escape
+		// the root, although symlinks themselves can still be matched.
+		m, err := doublestar.Glob(fsys, p, doublestar.WithNoFollow())
+		if err != nil {
+			return nil, fmt.Errorf("glob match '%s': %w", p, err)
+		}
+		for _, rel := range m {
+			if isGitPath(rel) || isExcluded(excludes, rel) {
+				continue
+			}
+			seen[rel] = struct{}{}
+		}
+	}
+
+	paths := make([]string, 0, len(seen))
+	for rel := range seen {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := ensureWithinDir(root, p); err != nil {
+			return nil, fmt.Errorf("check path %s: %w", rel, err)
+		}
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// isGitPath reports whether the slash-separated relative path is within, or
+// is, a `.git` directory.
+func isGitPath(rel string) bool {
+	return slices.Contains(strings.Split(rel, "/"), ".git")
+}
+
+// isExcluded reports whether the slash-separated relative path, or any of its
+// parent dirs, matches any of the exclusion patterns.
+func isExcluded(excludes []string, rel string) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		for _, e := range excludes {
+			if doublestar.MatchUnvalidated(e, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globTextFiles returns the regular text files in the working directory of the
+// step that match the patterns, optionally omitting gitignored files.
+func globTextFiles(ctx OperatorContext, patterns []string, gitignore bool) ([]string, error) {
+	root := ctx.workPath()
+	matches, err := globPaths(root, patterns)
+	if err != nil {
+		return nil, err
+	}
+	if gitignore {
+		if matches, err = filterGitIgnored(ctx.context(), root, matches); err != nil {
+			return nil, fmt.Errorf("filter ignored files: %w", err)
+		}
+	}
+
+	// NOTE: Only regular text files are returned since editing bytes in
+	// binary files would most likely corrupt them.
+	paths := make([]string, 0, len(matches))
+	for _, p := range matches {
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return nil, fmt.Errorf("stat file %s: %w", p, err)
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		binary, err := isBinaryFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("detect binary file %s: %w", p, err)
+		}
+		if binary {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// filterGitIgnored returns the paths that are not ignored by the gitignore
+// rules of the repository at dir. Tracked files are never considered ignored.
+func filterGitIgnored(ctx context.Context, dir string, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return paths, nil
+	}
+
+	var stdin, stdout, stderr bytes.Buffer
+	for _, p := range paths {
+		stdin.WriteString(p)
+		stdin.WriteByte(0)
+	}
+	c := exec.CommandContext(ctx, "git", "check-ignore", "--stdin", "-z")
+	c.Dir = dir
+	c.Stdin = &stdin
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		// NOTE: Exit code 1 means none of the paths are ignored
+		var e *exec.ExitError
+		if !errors.As(err, &e) || e.ExitCode() != 1 {
+			return nil, fmt.Errorf("check ignore: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	ignored := make(map[string]struct{})
+	for p := range strings.SplitSeq(stdout.String(), "\x00") {
+		ignored[p] = struct{}{}
+	}
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if _, ok := ignored[p]; !ok {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// isBinaryFile reports whether the file looks binary using the same heuristic
+// as Git, which is to look for a NUL byte within the first few kilobytes.
+func isBinaryFile(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	b := make([]byte, 8000)
+	n, err := io.ReadFull(f, b)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, fmt.Errorf("read file: %w", err)
+	}
+	return bytes.IndexByte(b[:n], 0) != -1, nil
+}
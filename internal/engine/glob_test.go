@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGlobPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"a.md":            "a",
+		"docs/b.md":       "b",
+		"docs/old/c.md":   "c",
+		"docs/d.txt":      "d",
+		".git/e.md":       "e",
+		"sub/.git/f.md":   "f",
+		"vendor/x/README": "r",
+	})
+	cases := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{name: "root", patterns: []string{"*.md"}, want: []string{"a.md"}},
+		{name: "recursive at root", patterns: []string{"**/*.md"}, want: []string{"a.md", "docs/b.md", "docs/old/c.md"}},
+		{name: "recursive nested", patterns: []string{"docs/**/*.md"}, want: []string{"docs/b.md", "docs/old/c.md"}},
+		{name: "exclude", patterns: []string{"**/*.md", "!docs/old/**"}, want: []string{"a.md", "docs/b.md"}},
+		{name: "exclude parent", patterns: []string{"docs/**", "!docs/old"}, want: []string{"docs", "docs/b.md", "docs/d.txt"}},
+		{name: "git dir", patterns: []string{".git/*", "**/.git/**"}, want: []string{}},
+		{name: "directory", patterns: []string{"vendor"}, want: []string{"vendor"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := globPaths(dir, tc.patterns)
+			if err != nil {
+				t.Fatalf("failed to glob: %v", err)
+			}
+			want := make([]string, 0, len(tc.want))
+			for _, p := range tc.want {
+				want = append(want, filepath.Join(dir, filepath.FromSlash(p)))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("unexpected paths: got %v, want %v", got, want)
+			}
+		})
+	}
+
+	for _, p := range []string{"../*.md", "docs/../../*.md", "!../*.md"} {
+		if _, err := globPaths(filepath.Join(dir, "docs"), []string{"*.md", p}); err == nil {
+			t.Errorf("expected error for pattern %s escaping the root", p)
+		}
+	}
+}
+
+func TestValidateGlobs(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		wantErr  bool
+	}{
+		{patterns: []string{"**/*.md", "!vendor/**"}},
+		{patterns: []string{"!vendor/**"}, wantErr: true},
+		{patterns: []string{"../*.md"}, wantErr: true},
+		{patterns: []string{"docs/../../*.md"}, wantErr: true},
+		{patterns: []string{"/etc/*"}, wantErr: true},
+		{patterns: []string{"[a"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		if err := validateGlobs(tc.patterns); (err != nil) != tc.wantErr {
+			t.Errorf("unexpected error for %v: %v", tc.patterns, err)
+		}
+	}
+}
+
+func TestGlobTextFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		".gitignore":     "build/\n",
+		"a.txt":          "a",
+		"bin.dat":        "a\x00b",
+		"build/out.txt":  "o",
+		"docs/guide.txt": "g",
+	})
+	if o, err := exec.Command("git", "init", "--quiet", dir).CombinedOutput(); err != nil {
+		t.Fatalf("failed to init repo: %v: %s", err, o)
+	}
+	cases := []struct {
+		name      string
+		gitignore bool
+		want      []string
+	}{
+		{name: "all", want: []string{"a.txt", "build/out.txt", "docs/guide.txt"}},
+		{name: "gitignore", gitignore: true, want: []string{"a.txt", "docs/guide.txt"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := globTextFiles(OperatorContext{Dir: dir}, []string{"**", "!.gitignore"}, tc.gitignore)
+			if err != nil {
+				t.Fatalf("failed to glob: %v", err)
+			}
+			want := make([]string, 0, len(tc.want))
+			for _, p := range tc.want {
+				want = append(want, filepath.Join(dir, filepath.FromSlash(p)))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("unexpected paths: got %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := globTextFiles(OperatorContext{Dir: dir, WorkDir: "docs"}, []string{"../*.txt"}, false); err == nil {
+		t.Errorf("expected error for pattern escaping the working dir")
+	}
+}
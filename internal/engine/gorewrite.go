@@ -0,0 +1,258 @@
+// This file is adapted from cmd/gofmt/rewrite.go of the Go project, which is
+// distributed under the following license:
+//
+// Copyright 2009 The Go Authors. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//    * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//    * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//    * Neither the name of Google LLC nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package engine
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NOTE: The rewriting below mirrors that of `gofmt -r`, where single
+// lowercase letter identifiers in the pattern are wildcards that match any
+// expression and are substituted into the replacement.
+
+var (
+	goObjectPtrNil = reflect.ValueOf((*ast.Object)(nil))
+	goScopePtrNil  = reflect.ValueOf((*ast.Scope)(nil))
+
+	goIdentType     = reflect.TypeOf((*ast.Ident)(nil))
+	goObjectPtrType = reflect.TypeOf((*ast.Object)(nil))
+	goPositionType  = reflect.TypeOf(token.NoPos)
+	goCallExprType  = reflect.TypeOf((*ast.CallExpr)(nil))
+	goScopePtrType  = reflect.TypeOf((*ast.Scope)(nil))
+)
+
+// rewriteGoFile replaces all occurrences of pattern with replace in f, and
+// reports whether any occurrence was found.
+func rewriteGoFile(fset *token.FileSet, pattern, replace ast.Expr, f *ast.File) (*ast.File, bool) {
+	cmap := ast.NewCommentMap(fset, f, f.Comments)
+	m := make(map[string]reflect.Value)
+	pat := reflect.ValueOf(pattern)
+	repl := reflect.ValueOf(replace)
+	matched := false
+
+	var rewriteVal func(val reflect.Value) reflect.Value
+	rewriteVal = func(val reflect.Value) reflect.Value {
+		if !val.IsValid() {
+			return reflect.Value{}
+		}
+		val = goApply(rewriteVal, val)
+		clear(m)
+		if goMatch(m, pat, val) {
+			matched = true
+			val = goSubst(m, repl, reflect.ValueOf(val.Interface().(ast.Node).Pos()))
+		}
+		return val
+	}
+
+	r := goApply(rewriteVal, reflect.ValueOf(f)).Interface().(*ast.File)
+	r.Comments = cmap.Filter(r).Comments()
+	return r, matched
+}
+
+func isGoWildcard(s string) bool {
+	r, size := utf8.DecodeRuneInString(s)
+	return size == len(s) && unicode.IsLower(r)
+}
+
+// goApply replaces each AST field x in val with f(x), returning val.
+func goApply(f func(reflect.Value) reflect.Value, val reflect.Value) reflect.Value {
+	if !val.IsValid() {
+		return reflect.Value{}
+	}
+	// NOTE: Objects and scopes introduce cycles and are likely incorrect
+	// after a rewrite, so they are replaced with nil instead.
+	if val.Type() == goObjectPtrType {
+		return goObjectPtrNil
+	}
+	if val.Type() == goScopePtrType {
+		return goScopePtrNil
+	}
+	switch v := reflect.Indirect(val); v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			e := v.Index(i)
+			goSetValue(e, f(e))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			e := v.Field(i)
+			goSetValue(e, f(e))
+		}
+	case reflect.Interface:
+		e := v.Elem()
+		goSetValue(v, f(e))
+	}
+	return val
+}
+
+func goSetValue(x, y reflect.Value) {
+	if !y.IsValid() {
+		return
+	}
+	// NOTE: A replacement may not fit where the pattern matched (e.g. an
+	// expression in place of an identifier), in which case it is ignored.
+	if !y.Type().AssignableTo(x.Type()) {
+		return
+	}
+	x.Set(y)
+}
+
+// goMatch reports whether pattern matches val, recording wildcard matches in m.
+func goMatch(m map[string]reflect.Value, pattern, val reflect.Value) bool {
+	// NOTE: A wildcard matches any expression, but must match the same
+	// expression each time it appears in the pattern.
+	if m != nil && pattern.IsValid() && pattern.Type() == goIdentType {
+		name := pattern.Interface().(*ast.Ident).Name
+		if isGoWildcard(name) && val.IsValid() {
+			if _, ok := val.Interface().(ast.Expr); ok && !val.IsNil() {
+				if old, ok := m[name]; ok {
+					return goMatch(nil, old, val)
+				}
+				m[name] = val
+				return true
+			}
+		}
+	}
+
+	if !pattern.IsValid() || !val.IsValid() {
+		return !pattern.IsValid() && !val.IsValid()
+	}
+	if pattern.Type() != val.Type() {
+		return false
+	}
+
+	switch pattern.Type() {
+	case goIdentType:
+		p := pattern.Interface().(*ast.Ident)
+		v := val.Interface().(*ast.Ident)
+		return p == nil && v == nil || p != nil && v != nil && p.Name == v.Name
+	case goObjectPtrType, goPositionType:
+		return true
+	case goCallExprType:
+		// NOTE: The ellipsis is what differentiates f(x) from f(x...)
+		p := pattern.Interface().(*ast.CallExpr)
+		v := val.Interface().(*ast.CallExpr)
+		if p.Ellipsis.IsValid() != v.Ellipsis.IsValid() {
+			return false
+		}
+	}
+
+	p := reflect.Indirect(pattern)
+	v := reflect.Indirect(val)
+	if !p.IsValid() || !v.IsValid() {
+		return !p.IsValid() && !v.IsValid()
+	}
+
+	switch p.Kind() {
+	case reflect.Slice:
+		if p.Len() != v.Len() {
+			return false
+		}
+		for i := 0; i < p.Len(); i++ {
+			if !goMatch(m, p.Index(i), v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < p.NumField(); i++ {
+			if !goMatch(m, p.Field(i), v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Interface:
+		return goMatch(m, p.Elem(), v.Elem())
+	}
+	return p.Interface() == v.Interface()
+}
+
+// goSubst returns a copy of pattern with wildcards substituted from m, and
+// with valid positions replaced by pos if it is valid.
+func goSubst(m map[string]reflect.Value, pattern reflect.Value, pos reflect.Value) reflect.Value {
+	if !pattern.IsValid() {
+		return reflect.Value{}
+	}
+
+	if m != nil && pattern.Type() == goIdentType {
+		name := pattern.Interface().(*ast.Ident).Name
+		if isGoWildcard(name) {
+			if old, ok := m[name]; ok {
+				return goSubst(nil, old, reflect.Value{})
+			}
+		}
+	}
+
+	if pos.IsValid() && pattern.Type() == goPositionType {
+		if old := pattern.Interface().(token.Pos); !old.IsValid() {
+			return pattern
+		}
+		return pos
+	}
+
+	switch p := pattern; p.Kind() {
+	case reflect.Slice:
+		// NOTE: Nil slices are kept as-is since go/ast guarantees that
+		// certain lists are nil if not populated.
+		if p.IsNil() {
+			return reflect.Zero(p.Type())
+		}
+		v := reflect.MakeSlice(p.Type(), p.Len(), p.Len())
+		for i := 0; i < p.Len(); i++ {
+			v.Index(i).Set(goSubst(m, p.Index(i), pos))
+		}
+		return v
+	case reflect.Struct:
+		v := reflect.New(p.Type()).Elem()
+		for i := 0; i < p.NumField(); i++ {
+			v.Field(i).Set(goSubst(m, p.Field(i), pos))
+		}
+		return v
+	case reflect.Pointer:
+		v := reflect.New(p.Type()).Elem()
+		if elem := p.Elem(); elem.IsValid() {
+			v.Set(goSubst(m, elem, pos).Addr())
+		}
+		return v
+	case reflect.Interface:
+		v := reflect.New(p.Type()).Elem()
+		if elem := p.Elem(); elem.IsValid() {
+			v.Set(goSubst(m, elem, pos))
+		}
+		return v
+	}
+	return pattern
+}
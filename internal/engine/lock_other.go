@@ -0,0 +1,139 @@
+//go:build !unix
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NOTE: Without flock, locks are held by creating files exclusively. Holders
+// refresh the modification time of their files, so that the files left
+// behind by processes that did not exit cleanly are taken over once stale.
+const (
+	lockPollInterval    = 100 * time.Millisecond
+	lockRefreshInterval = 10 * time.Second
+	lockStaleAfter      = time.Minute
+)
+
+// lockFile acquires a lock on the file, and blocks until it is acquired.
+// Shared locks can be held by several holders at once, unlike exclusive
+// locks. The lock is released by the returned function.
+func lockFile(name string, shared bool) (func() error, error) {
+	for {
+		unlock, ok, err := tryLock(name, shared)
+		if err != nil || ok {
+			return unlock, err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// tryLockFile acquires an exclusive lock on the file if it is not held, and
+// reports whether it was acquired.
+func tryLockFile(name string) (func() error, bool, error) {
+	return tryLock(name, false)
+}
+
+func tryLock(name string, shared bool) (func() error, bool, error) {
+	release, ok, err := createLockFile(name + ".held")
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	dir, base := filepath.Dir(name), filepath.Base(name)
+	if shared {
+		// NOTE: Shared holders only hold the exclusive file while their own
+		// file is created, so that exclusive holders wait for them below
+		defer release()
+		f, err := os.CreateTemp(dir, base+".*.shared")
+		if err != nil {
+			return nil, false, fmt.Errorf("create lock file: %w", err)
+		}
+		f.Close()
+		return holdLockFile(f.Name()), true, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		release()
+		return nil, false, fmt.Errorf("read lock dir: %w", err)
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), base+".") || !strings.HasSuffix(e.Name(), ".shared") {
+			continue
+		}
+		stale, err := removeStaleLockFile(filepath.Join(dir, e.Name()))
+		if err != nil || !stale {
+			release()
+			return nil, false, err
+		}
+	}
+	return release, true, nil
+}
+
+// createLockFile creates the file exclusively, taking it over if it is
+// stale, and reports whether it was created.
+func createLockFile(name string) (func() error, bool, error) {
+	for range 2 {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return holdLockFile(name), true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, false, fmt.Errorf("create lock file: %w", err)
+		}
+		stale, err := removeStaleLockFile(name)
+		if err != nil || !stale {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+// removeStaleLockFile removes the file if it has not been refreshed by its
+// holder, and reports whether it was removed.
+func removeStaleLockFile(name string) (bool, error) {
+	fi, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat lock file: %w", err)
+	}
+	if time.Since(fi.ModTime()) < lockStaleAfter {
+		return false, nil
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("remove stale lock file: %w", err)
+	}
+	return true, nil
+}
+
+// holdLockFile refreshes the file until the returned function is called,
+// which removes it.
+func holdLockFile(name string) func() error {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(lockRefreshInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-t.C:
+				_ = os.Chtimes(name, now, now)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() error {
+		once.Do(func() { close(done) })
+		return os.Remove(name)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build unix
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile acquires a lock on the file, which is created if it does not
+// exist, and blocks until it is acquired. Shared locks can be held by several
+// holders at once, unlike exclusive locks. The lock is released by the
+// returned function, or when the process exits.
+func lockFile(name string, shared bool) (func() error, error) {
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
+	unlock, _, err := flockFile(name, how)
+	return unlock, err
+}
+
+// tryLockFile acquires an exclusive lock on the file if it is not held, and
+// reports whether it was acquired.
+func tryLockFile(name string) (func() error, bool, error) {
+	return flockFile(name, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func flockFile(name string, how int) (func() error, bool, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("open lock file: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("lock file: %w", err)
+	}
+	return func() error {
+		defer f.Close()
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}, true, nil
+}
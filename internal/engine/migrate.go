@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+// planMigration migrates the document of a plan from a version to the next.
+// Migrations edit the document in place so that its comments are preserved.
+type planMigration func(doc *ast.MappingNode) error
+
+// planMigrations are the migrations of plans, indexed by the version that they
+// migrate from. Plans of older versions are migrated to the latest version
+// when they are loaded, which is the only version that is decoded.
+var planMigrations = []planMigration{}
+
+// LatestPlanVersion returns the latest version of plans.
+func LatestPlanVersion() int {
+	return len(planMigrations)
+}
+
+// migratePlanNode migrates the document of the plan to the latest version in
+// place, and returns the version that it was migrated from. Documents that
+// are not plans, or do not specify a version, are left to the schema.
+func migratePlanNode(node ast.Node) (int, error) {
+	latest := LatestPlanVersion()
+	m, ok := unwrapNode(node).(*ast.MappingNode)
+	if !ok {
+		return latest, nil
+	}
+	i := slices.IndexFunc(m.Values, func(mv *ast.MappingValueNode) bool {
+		return mv.Key.GetToken().Value == "version"
+	})
+	if i < 0 {
+		return latest, nil
+	}
+	mv := m.Values[i]
+	n, ok := unwrapNode(mv.Value).(*ast.IntegerNode)
+	if !ok {
+		return latest, nil
+	}
+	from, err := strconv.Atoi(n.Token.Value)
+	if err != nil || from < 0 {
+		return latest, nil
+	}
+	if from > latest {
+		return 0, fmt.Errorf("unsupported plan version %d, the latest supported version is %d", from, latest)
+	}
+	for v := from; v < latest; v++ {
+		if err := planMigrations[v](m); err != nil {
+			return 0, fmt.Errorf("migrate from version %d: %w", v, err)
+		}
+	}
+	if from < latest {
+		s := strconv.Itoa(latest)
+		version := ast.Integer(token.New(s, s, n.Token.Position))
+		if err := version.SetComment(mv.Value.GetComment()); err != nil {
+			return 0, fmt.Errorf("set comment: %w", err)
+		}
+		mv.Value = version
+	}
+	return from, nil
+}
+
+// migratePlanValue migrates the document of the plan to the latest version,
+// and returns the decoded value of the document if it was migrated or the
+// value otherwise. The document may be nil if it cannot be parsed.
+func migratePlanValue(v any, doc ast.Node) (any, error) {
+	if doc == nil {
+		return v, nil
+	}
+	from, err := migratePlanNode(doc)
+	if err != nil {
+		return nil, err
+	}
+	if from == LatestPlanVersion() {
+		return v, nil
+	}
+	return yamlNodeToJSON(doc)
+}
+
+// MigrateFile migrates the plans in the file to the latest version, which is
+// read from stdin if the name is -. It returns the content of the migrated
+// file and whether any plan was migrated. Comments of YAML plans are
+// preserved, while JSON plans are reformatted. Base plans and step fragments
+// referenced by the plans are not migrated.
+func MigrateFile(name string) ([]byte, bool, error) {
+	b, err := readPlanFile(name)
+	if err != nil {
+		return nil, false, fmt.Errorf("read file: %w", err)
+	}
+	// NOTE: JSON plans are migrated as YAML, which is a superset of JSON
+	file, err := parser.ParseBytes(b, parser.ParseComments)
+	if err != nil {
+		return nil, false, fmt.Errorf("parse plan: %w", err)
+	}
+	docs := yamlDocuments(file)
+	if len(docs) == 0 {
+		return nil, false, fmt.Errorf("no plan found")
+	}
+	var migrated bool
+	for i, doc := range docs {
+		from, err := migratePlanNode(doc)
+		if err != nil {
+			if len(docs) > 1 {
+				return nil, false, fmt.Errorf("document %d: %w", i, err)
+			}
+			return nil, false, err
+		}
+		migrated = migrated || from < LatestPlanVersion()
+	}
+	if !migrated {
+		return b, false, nil
+	}
+	if planFormat(name, b) == planFormatJSON {
+		v, err := yamlNodeToJSON(docs[0])
+		if err != nil {
+			return nil, false, fmt.Errorf("convert plan: %w", err)
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return nil, false, fmt.Errorf("encode plan: %w", err)
+		}
+		return buf.Bytes(), true, nil
+	}
+	return []byte(file.String()), true, nil
+}
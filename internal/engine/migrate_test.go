@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/token"
+)
+
+// withRenameMigration registers a migration from the latest version that
+// renames the name key of plans to id.
+func withRenameMigration(t *testing.T) {
+	t.Helper()
+	orig := planMigrations
+	t.Cleanup(func() { planMigrations = orig })
+	planMigrations = append(orig[:len(orig):len(orig)], func(doc *ast.MappingNode) error {
+		for _, mv := range doc.Values {
+			if tk := mv.Key.GetToken(); tk.Value == "name" {
+				mv.Key = ast.String(token.New("id", "id", tk.Position))
+			}
+		}
+		return nil
+	})
+}
+
+func TestMigrateFile(t *testing.T) {
+	withRenameMigration(t)
+	from := LatestPlanVersion() - 1
+	name := filepath.Join(t.TempDir(), "plan.yml")
+	content := strings.Join([]string{
+		"# Formats the frontend repositories",
+		"version: " + strconv.Itoa(from) + " # bumped by migrate",
+		"name: test",
+		"on:",
+		"  repositories:",
+		"    - owner/repo # frontend",
+		"steps: []",
+		"commit: {title: t, body: b}",
+		"",
+	}, "\n")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, migrated, err := MigrateFile(name)
+	if err != nil {
+		t.Fatalf("failed to migrate plan: %v", err)
+	}
+	if !migrated {
+		t.Fatalf("plan is not migrated")
+	}
+	got := string(b)
+	for _, want := range []string{
+		"# Formats the frontend repositories",
+		"version: " + strconv.Itoa(from+1) + " # bumped by migrate",
+		"id: test",
+		"# frontend",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("migrated plan does not contain %q:\n%s", want, got)
+		}
+	}
+
+	// NOTE: Older plans are also migrated when they are loaded
+	p, err := NewPlanFromYAML(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("failed to decode plan: %v", err)
+	}
+	if p.ID != "test" || p.Version != from+1 {
+		t.Errorf("unexpected plan: %+v", p)
+	}
+}
+
+func TestNewPlanFromYAMLUnsupportedVersion(t *testing.T) {
+	_, err := NewPlanFromYAML(strings.NewReader("version: 99\nid: test\non:\n  repositories: [owner/repo]\nsteps: []\ncommit: {title: t, body: b}\n"))
+	want := "unsupported plan version 99"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("unexpected error: got %v, want %q", err, want)
+	}
+}
@@ -1,7 +1,31 @@
 package engine
 
+import (
+	"context"
+	"path/filepath"
+)
+
 type OperatorContext struct {
-	Dir string
+	Context context.Context // Context bounding the execution of the step
+	Dir     string          // Local worktree of the repository
+	WorkDir string          // Working directory of the step, relative to Dir
+	PlanDir string          // Directory containing the plan file
+	Env     []string        // Additional environment variables in KEY=VALUE form
+
+	Template TemplateContext // Template context of the repository
+}
+
+// context returns the context of the step, defaulting to a background context.
+func (c OperatorContext) context() context.Context {
+	if c.Context == nil {
+		return context.Background()
+	}
+	return c.Context
+}
+
+// workPath returns the path of the working directory of the step.
+func (c OperatorContext) workPath() string {
+	return filepath.Join(c.Dir, c.WorkDir)
 }
 
 type Operator interface {
@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+func init() {
+	registerOperator("ensure", (*OperatorEnsure)(nil), "line", "block")
+}
+
+const (
+	ensureStatePresent = "present"
+	ensureStateAbsent  = "absent"
+)
+
+const (
+	ensureAnchorBOF = "BOF"
+	ensureAnchorEOF = "EOF"
+)
+
+const ensureDefaultMarker = "# {mark} BULK MANAGED BLOCK"
+
+// OperatorEnsure details the lines or blocks to ensure in targeted files.
+type OperatorEnsure struct {
+	// List of file paths to operate on. Accepts Glob expressions including
+	// `**`, and patterns prefixed with `!` are excluded.
+	Target []string `json:"target"`
+	// Line that should be present or absent.
+	Line string `json:"line,omitempty"`
+	// Block of text that should be present or absent between markers.
+	Block string `json:"block,omitempty"`
+	// Regular expression matching the line to replace or remove.
+	Regexp string `json:"regexp,omitempty"`
+	// Marker line template surrounding the block. Must contain a {mark}
+	// placeholder.
+	Marker string `json:"marker,omitempty"`
+	// Whether the line or block should be present or absent.
+	State string `json:"state,omitempty" jsonschema:"enum=present,absent"`
+	// Regular expression matching the line to insert after, or BOF or EOF.
+	InsertAfter string `json:"insertAfter,omitempty"`
+	// Regular expression matching the line to insert before, or BOF or EOF.
+	InsertBefore string `json:"insertBefore,omitempty"`
+	// Whether to create the file if it does not exist.
+	Create bool `json:"create,omitempty"`
+}
+
+func (op *OperatorEnsure) targets() []string {
+	return op.Target
+}
+
+func (op *OperatorEnsure) Validate() error {
+	if len(op.Target) == 0 {
+		return fmt.Errorf("target is not specified")
+	}
+	if err := validateGlobs(op.Target); err != nil {
+		return fmt.Errorf("target is not valid: %w", err)
+	}
+	switch op.State {
+	case "", ensureStatePresent, ensureStateAbsent:
+	default:
+		return fmt.Errorf("unknown state: %s", op.State)
+	}
+	if op.Line != "" && op.Block != "" {
+		return fmt.Errorf("line and block are mutually exclusive")
+	}
+	if op.Block == "" {
+		if op.Marker != "" {
+			return fmt.Errorf("marker is only supported with block")
+		}
+		if strings.Contains(op.Line, "\n") {
+			return fmt.Errorf("line must not contain newlines")
+		}
+		if op.Line == "" && (op.state() == ensureStatePresent || op.Regexp == "") {
+			return fmt.Errorf("line or block is not specified")
+		}
+	} else {
+		if op.Regexp != "" {
+			return fmt.Errorf("regexp is only supported with line")
+		}
+		if m := op.Marker; m != "" && strings.Count(m, "{mark}") != 1 {
+			return fmt.Errorf("marker must contain exactly one {mark} placeholder")
+		}
+	}
+	if op.InsertAfter != "" && op.InsertBefore != "" {
+		return fmt.Errorf("insertAfter and insertBefore are mutually exclusive")
+	}
+	for name, expr := range map[string]string{
+		"regexp":       op.Regexp,
+		"insertAfter":  op.InsertAfter,
+		"insertBefore": op.InsertBefore,
+	} {
+		if expr == "" || expr == ensureAnchorBOF || expr == ensureAnchorEOF {
+			continue
+		}
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("%s is not a valid regex: %w", name, err)
+		}
+	}
+	// NOTE: The line would not be found by the regexp on a re-run, which
+	// would insert it again
+	if op.Regexp != "" && op.Line != "" && op.state() == ensureStatePresent {
+		if !regexp.MustCompile(op.Regexp).MatchString(op.Line) {
+			return fmt.Errorf("line must match regexp")
+		}
+	}
+	return nil
+}
+
+func (op *OperatorEnsure) Apply(ctx OperatorContext) error {
+	root := ctx.workPath()
+	paths, err := globTextFiles(ctx, op.Target, false)
+	if err != nil {
+		return fmt.Errorf("resolve target: %w", err)
+	}
+	if len(paths) == 0 && op.Create && op.state() == ensureStatePresent {
+		// NOTE: Only literal paths can be created since globs do not
+		// describe which file is expected.
+		for _, t := range op.Target {
+			if strings.HasPrefix(t, globExcludePrefix) || hasGlobMeta(t) {
+				continue
+			}
+			p, err := resolvePath(root, t)
+			if err != nil {
+				return fmt.Errorf("resolve target: %w", err)
+			}
+			// NOTE: Existing files that are skipped as binary or not
+			// regular must not be overwritten
+			if _, err := os.Lstat(p); err == nil {
+				continue
+			}
+			paths = append(paths, p)
+		}
+	}
+
+	for _, p := range paths {
+		perm := fs.FileMode(0644)
+		b, err := os.ReadFile(p)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return fmt.Errorf("create parent dir: %w", err)
+			}
+		case err != nil:
+			return fmt.Errorf("read file %s: %w", p, err)
+		default:
+			fi, err := os.Stat(p)
+			if err != nil {
+				return fmt.Errorf("stat file %s: %w", p, err)
+			}
+			perm = fi.Mode().Perm()
+		}
+
+		exists := err == nil
+		eol := lineEnding(string(b))
+		lines := splitLines(string(b))
+		var out []string
+		if op.Block != "" {
+			if out, err = op.ensureBlock(lines); err != nil {
+				return fmt.Errorf("ensure block in %s: %w", p, err)
+			}
+		} else {
+			out = op.ensureLine(lines)
+		}
+
+		if exists && slices.Equal(lines, out) {
+			continue
+		}
+		if err := os.WriteFile(p, []byte(joinLines(out, eol)), perm); err != nil {
+			return fmt.Errorf("write file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (op *OperatorEnsure) state() string {
+	if op.State == "" {
+		return ensureStatePresent
+	}
+	return op.State
+}
+
+func (op *OperatorEnsure) ensureLine(lines []string) []string {
+	match := func(l string) bool { return l == op.Line }
+	if op.Regexp != "" {
+		re := regexp.MustCompile(op.Regexp)
+		match = re.MatchString
+	}
+
+	if op.state() == ensureStateAbsent {
+		out := make([]string, 0, len(lines))
+		for _, l := range lines {
+			if !match(l) {
+				out = append(out, l)
+			}
+		}
+		return out
+	}
+
+	// NOTE: Similar to Ansible, the last matching line is replaced when a
+	// regexp is given, which keeps re-runs from inserting duplicates.
+	for i := len(lines) - 1; i >= 0; i-- {
+		if match(lines[i]) {
+			out := append([]string(nil), lines...)
+			out[i] = op.Line
+			return out
+		}
+	}
+	return insertLines(lines, op.insertIndex(lines), op.Line)
+}
+
+func (op *OperatorEnsure) ensureBlock(lines []string) ([]string, error) {
+	marker := op.Marker
+	if marker == "" {
+		marker = ensureDefaultMarker
+	}
+	begin := strings.Replace(marker, "{mark}", "BEGIN", 1)
+	end := strings.Replace(marker, "{mark}", "END", 1)
+
+	start, stop := -1, -1
+	for i, l := range lines {
+		if l == begin && start == -1 {
+			start = i
+		}
+		if l == end && start != -1 {
+			stop = i
+			break
+		}
+	}
+	// NOTE: Inserting another block would leave the unbalanced marker behind
+	switch {
+	case start != -1 && stop == -1:
+		return nil, fmt.Errorf("marker %q has no matching %q", begin, end)
+	case start == -1 && slices.Contains(lines, end):
+		return nil, fmt.Errorf("marker %q has no matching %q", end, begin)
+	}
+
+	var block []string
+	if op.state() == ensureStatePresent {
+		block = append(block, begin)
+		block = append(block, splitLines(op.Block)...)
+		block = append(block, end)
+	}
+
+	if start != -1 && stop != -1 {
+		out := make([]string, 0, len(lines)-(stop-start+1)+len(block))
+		out = append(out, lines[:start]...)
+		out = append(out, block...)
+		return append(out, lines[stop+1:]...), nil
+	}
+	if len(block) == 0 {
+		return lines, nil
+	}
+	return insertLines(lines, op.insertIndex(lines), block...), nil
+}
+
+// insertIndex returns the index that new lines should be inserted at based on
+// the configured anchors. Unmatched anchors fall back to the end of file.
+func (op *OperatorEnsure) insertIndex(lines []string) int {
+	switch {
+	case op.InsertBefore == ensureAnchorBOF, op.InsertAfter == ensureAnchorBOF:
+		return 0
+	case op.InsertBefore == ensureAnchorEOF:
+		return len(lines)
+	case op.InsertBefore != "":
+		re := regexp.MustCompile(op.InsertBefore)
+		for i, l := range lines {
+			if re.MatchString(l) {
+				return i
+			}
+		}
+	case op.InsertAfter != "" && op.InsertAfter != ensureAnchorEOF:
+		re := regexp.MustCompile(op.InsertAfter)
+		for i := len(lines) - 1; i >= 0; i-- {
+			if re.MatchString(lines[i]) {
+				return i + 1
+			}
+		}
+	}
+	return len(lines)
+}
+
+func insertLines(lines []string, i int, add ...string) []string {
+	out := make([]string, 0, len(lines)+len(add))
+	out = append(out, lines[:i]...)
+	out = append(out, add...)
+	return append(out, lines[i:]...)
+}
+
+// lineEnding returns the line ending of the content, which is CRLF if any
+// line ends with it.
+func lineEnding(s string) string {
+	if strings.Contains(s, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// splitLines splits the content into lines, omitting the trailing newline and
+// the carriage returns of CRLF line endings.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// joinLines joins the lines into content terminated by the line ending.
+func joinLines(lines []string, eol string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, eol) + eol
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOperatorEnsureApply(t *testing.T) {
+	cases := []struct {
+		name string
+		op   OperatorEnsure
+		src  string
+		want string
+	}{
+		{
+			name: "line",
+			op:   OperatorEnsure{Line: "c"},
+			src:  "a\nb\n",
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "line before BOF",
+			op:   OperatorEnsure{Line: "c", InsertBefore: "BOF"},
+			src:  "a\nb\n",
+			want: "c\na\nb\n",
+		},
+		{
+			name: "line after BOF",
+			op:   OperatorEnsure{Line: "c", InsertAfter: "BOF"},
+			src:  "a\nb\n",
+			want: "c\na\nb\n",
+		},
+		{
+			name: "line before EOF",
+			op:   OperatorEnsure{Line: "c", InsertBefore: "EOF"},
+			src:  "a\nb\n",
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "line after match",
+			op:   OperatorEnsure{Line: "c", InsertAfter: "^a$"},
+			src:  "a\nb\n",
+			want: "a\nc\nb\n",
+		},
+		{
+			name: "regexp",
+			op:   OperatorEnsure{Line: "go 1.24", Regexp: `^go \d+\.\d+$`},
+			src:  "module x\n\ngo 1.22\n",
+			want: "module x\n\ngo 1.24\n",
+		},
+		{
+			name: "absent line",
+			op:   OperatorEnsure{Line: "b", State: "absent"},
+			src:  "a\nb\nc\nb\n",
+			want: "a\nc\n",
+		},
+		{
+			name: "absent regexp",
+			op:   OperatorEnsure{Regexp: "^#", State: "absent"},
+			src:  "# a\nb\n# c\n",
+			want: "b\n",
+		},
+		{
+			name: "block",
+			op:   OperatorEnsure{Block: "x\ny"},
+			src:  "a\n",
+			want: "a\n# BEGIN BULK MANAGED BLOCK\nx\ny\n# END BULK MANAGED BLOCK\n",
+		},
+		{
+			name: "block replaced",
+			op:   OperatorEnsure{Block: "z"},
+			src:  "a\n# BEGIN BULK MANAGED BLOCK\nx\n# END BULK MANAGED BLOCK\nb\n",
+			want: "a\n# BEGIN BULK MANAGED BLOCK\nz\n# END BULK MANAGED BLOCK\nb\n",
+		},
+		{
+			name: "absent block",
+			op:   OperatorEnsure{Block: "x", State: "absent"},
+			src:  "a\n# BEGIN BULK MANAGED BLOCK\nx\n# END BULK MANAGED BLOCK\nb\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "crlf line",
+			op:   OperatorEnsure{Line: "c"},
+			src:  "a\r\nb\r\n",
+			want: "a\r\nb\r\nc\r\n",
+		},
+		{
+			name: "crlf existing line",
+			op:   OperatorEnsure{Line: "b"},
+			src:  "a\r\nb\r\n",
+			want: "a\r\nb\r\n",
+		},
+		{
+			name: "crlf block",
+			op:   OperatorEnsure{Block: "x"},
+			src:  "a\r\n",
+			want: "a\r\n# BEGIN BULK MANAGED BLOCK\r\nx\r\n# END BULK MANAGED BLOCK\r\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := filepath.Join(dir, "f")
+			if err := os.WriteFile(p, []byte(tc.src), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			tc.op.Target = []string{"f"}
+			if err := tc.op.Validate(); err != nil {
+				t.Fatalf("invalid operator: %v", err)
+			}
+			// NOTE: Re-runs must not change the file again
+			for run := range 2 {
+				if err := tc.op.Apply(OperatorContext{Dir: dir}); err != nil {
+					t.Fatalf("failed to apply run %d: %v", run, err)
+				}
+				b, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatalf("failed to read file: %v", err)
+				}
+				if got := string(b); got != tc.want {
+					t.Errorf("unexpected file after run %d:\ngot  %q\nwant %q", run, got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOperatorEnsureValidate(t *testing.T) {
+	op := OperatorEnsure{Target: []string{"go.mod"}, Line: "toolchain go1.24", Regexp: `^go \d+`}
+	if err := op.Validate(); err == nil || !strings.Contains(err.Error(), "line must match regexp") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOperatorEnsureUnbalancedMarkers(t *testing.T) {
+	for name, src := range map[string]string{
+		"missing end":   "# BEGIN BULK MANAGED BLOCK\nx\n",
+		"missing begin": "x\n# END BULK MANAGED BLOCK\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "f"), []byte(src), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			op := OperatorEnsure{Target: []string{"f"}, Block: "y"}
+			if err := op.Apply(OperatorContext{Dir: dir}); err == nil || !strings.Contains(err.Error(), "has no matching") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestOperatorEnsureSkipsBinaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"bin":       "a\x00b",
+		"dir/.keep": "",
+		"text":      "a\n",
+	})
+	for _, target := range [][]string{{"*"}, {"bin"}, {"dir"}} {
+		op := OperatorEnsure{Target: target, Line: "c", Create: true}
+		if err := op.Apply(OperatorContext{Dir: dir}); err != nil {
+			t.Fatalf("failed to apply %v: %v", target, err)
+		}
+	}
+	want := map[string]string{
+		"bin":       "a\x00b",
+		"dir/.keep": "",
+		"text":      "a\nc\n",
+	}
+	if got := readTestFiles(t, dir); !maps.Equal(got, want) {
+		t.Errorf("unexpected files: got %q, want %q", got, want)
+	}
+}
@@ -2,25 +2,119 @@ package engine
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 )
 
-var _ Operator = (*OperatorExecScript)(nil)
+func init() {
+	registerOperator("script", (*OperatorExecScript)(nil), "run")
+}
+
+// containerWorkDir is the path that the worktree is mounted at within the
+// container when running scripts in a container.
+const containerWorkDir = "/workspace"
+
+// containerScriptPath is the path that the script is mounted at within the
+// container when running scripts in a container.
+const containerScriptPath = "/tmp/bulk-script"
+
+// containerRuntimes lists the supported container runtimes in the order of
+// preference when auto-detecting.
+var containerRuntimes = []string{"docker", "podman"}
 
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// scriptPlaceholder is substituted with the path of the script file in the
+// shell command template.
+const scriptPlaceholder = "{0}"
+
+// defaultShell is the shell used when none is specified.
+const defaultShell = "bash"
+
+type scriptShell struct {
+	command []string // Command template to run the script file with
+	ext     string   // Extension of the script file
+}
+
+// scriptShells lists the built-in shells, each configured to fail fast where
+// the interpreter supports it.
+var scriptShells = map[string]scriptShell{
+	"sh":      {command: []string{"sh", "-e", "{0}"}, ext: ".sh"},
+	"bash":    {command: []string{"bash", "--noprofile", "--norc", "-euo", "pipefail", "{0}"}, ext: ".sh"},
+	"zsh":     {command: []string{"zsh", "-euo", "pipefail", "{0}"}, ext: ".zsh"},
+	"python3": {command: []string{"python3", "-u", "{0}"}, ext: ".py"},
+	"node":    {command: []string{"node", "{0}"}, ext: ".js"},
+}
+
+// OperatorExecScript details the shell script to be executed.
 type OperatorExecScript struct {
+	// Shell script to execute on the targeted repository.
 	Run string `json:"run"`
+	// Shell used to run the script. Accepts sh, bash, zsh, python3, node or a
+	// custom command template containing {0}, which is split into arguments
+	// like a shell command.
+	Shell string `json:"shell,omitempty"`
+	// Container image to run the script in. Runs on the host if unspecified.
+	Image string `json:"image,omitempty"`
+	// Container runtime used to run the image. Auto-detected if unspecified.
+	Runtime string `json:"runtime,omitempty" jsonschema:"enum=docker,podman"`
+	// Whether the container has network access.
+	Network bool `json:"network,omitempty"`
+	// Names of host environment variables passed into the container.
+	PassEnv []string `json:"passEnv,omitempty" jsonschema:"pattern=^[A-Za-z_][A-Za-z0-9_]*$"`
+}
+
+func (*OperatorExecScript) extendSchema(g *schemaGenerator, s *jsonSchema) {
+	extendShellSchema(s.Properties.get("shell"))
+}
+
+// extendShellSchema describes the shell property of scripts, which is either
+// a built-in shell or a command template.
+func extendShellSchema(shell *jsonSchema) {
+	shell.Default = defaultShell
+	shell.AnyOf = []*jsonSchema{
+		{Enum: slices.Sorted(maps.Keys(scriptShells))},
+		{Pattern: `\{0\}`},
+	}
 }
 
 func (op *OperatorExecScript) Validate() error {
 	if op.Run == "" {
 		return fmt.Errorf("run is not specified")
 	}
+	if _, err := op.shell(); err != nil {
+		return fmt.Errorf("shell is not valid: %w", err)
+	}
+	if op.Image == "" {
+		if op.Runtime != "" || op.Network || len(op.PassEnv) > 0 {
+			return fmt.Errorf("runtime, network and passEnv are only supported with image")
+		}
+		return nil
+	}
+	if op.Runtime != "" && !slices.Contains(containerRuntimes, op.Runtime) {
+		return fmt.Errorf("unknown runtime: %s", op.Runtime)
+	}
+	for i, name := range op.PassEnv {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("passEnv.%d is not a valid variable name: %s", i, name)
+		}
+	}
 	return nil
 }
 
 func (op *OperatorExecScript) Apply(ctx OperatorContext) error {
-	// TODO: Support running in container?
-	f, err := os.CreateTemp("", "script-*.sh")
+	sh, err := op.shell()
+	if err != nil {
+		return fmt.Errorf("get shell: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "script-*"+sh.ext)
 	if err != nil {
 		return fmt.Errorf("create temp script file: %w", err)
 	}
@@ -33,6 +127,119 @@ func (op *OperatorExecScript) Apply(ctx OperatorContext) error {
 		return fmt.Errorf("close script file: %w", err)
 	}
 
-	// TODO: Support other shells?
-	return dirExec(ctx.Dir, "bash", "-euo", "pipefail", f.Name())
+	if op.Image != "" {
+		return op.applyContainer(ctx, sh, f.Name())
+	}
+	args := sh.args(f.Name())
+	return dirExecContext(ctx.context(), ctx.workPath(), ctx.Env, args[0], args[1:]...)
+}
+
+func (op *OperatorExecScript) applyContainer(ctx OperatorContext, sh scriptShell, script string) error {
+	runtime, err := op.runtime()
+	if err != nil {
+		return fmt.Errorf("detect container runtime: %w", err)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return fmt.Errorf("generate container name: %w", err)
+	}
+	container := "bulk-" + id
+
+	args := op.containerArgs(ctx, runtime, container, sh, script)
+	if err := dirExecContext(ctx.context(), ctx.Dir, ctx.Env, runtime, args...); err != nil {
+		// NOTE: Killing the runtime client does not stop the container, so
+		// it has to be killed explicitly when the step is cancelled.
+		if ctx.context().Err() != nil {
+			_ = exec.Command(runtime, "kill", container).Run()
+		}
+		return err
+	}
+	return nil
+}
+
+// containerArgs returns the arguments of the container runtime to run the
+// script in a container with the given name.
+func (op *OperatorExecScript) containerArgs(ctx OperatorContext, runtime, container string, sh scriptShell, script string) []string {
+	args := []string{
+		"run", "--rm",
+		"--name", container,
+		"--volume", fmt.Sprintf("%s:%s", ctx.Dir, containerWorkDir),
+		"--volume", fmt.Sprintf("%s:%s:ro", script, containerScriptPath+sh.ext),
+		"--workdir", path.Join(containerWorkDir, filepath.ToSlash(ctx.WorkDir)),
+		// NOTE: Running as the invoking user ensures that files created in
+		// the worktree are not owned by root on the host.
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}
+	if runtime == "podman" {
+		// NOTE: Rootless podman maps root in the container to the invoking
+		// user, so the user namespace needs to be kept for the same effect.
+		args = append(args, "--userns", "keep-id")
+	}
+	if !op.Network {
+		args = append(args, "--network", "none")
+	}
+	for _, name := range op.PassEnv {
+		// NOTE: Passing only the name forwards the value from the host
+		// without exposing it in the process arguments.
+		if _, ok := os.LookupEnv(name); ok {
+			args = append(args, "--env", name)
+		}
+	}
+	for _, kv := range ctx.Env {
+		// NOTE: Step variables are set on the runtime process, so only the
+		// names need to be forwarded.
+		k, _, _ := strings.Cut(kv, "=")
+		args = append(args, "--env", k)
+	}
+	args = append(args, op.Image)
+	return append(args, sh.args(containerScriptPath+sh.ext)...)
+}
+
+func (op *OperatorExecScript) runtime() (string, error) {
+	if op.Runtime != "" {
+		if _, err := exec.LookPath(op.Runtime); err != nil {
+			return "", fmt.Errorf("look up %s: %w", op.Runtime, err)
+		}
+		return op.Runtime, nil
+	}
+	for _, r := range containerRuntimes {
+		if _, err := exec.LookPath(r); err == nil {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("none of %v found in PATH", containerRuntimes)
+}
+
+func (op *OperatorExecScript) shell() (scriptShell, error) {
+	name := op.Shell
+	if name == "" {
+		name = defaultShell
+	}
+	if sh, ok := scriptShells[name]; ok {
+		return sh, nil
+	}
+
+	// NOTE: Similar to GitHub Actions, custom shells are specified as a
+	// command template where the placeholder is the path of the script.
+	if !strings.Contains(name, scriptPlaceholder) {
+		return scriptShell{}, fmt.Errorf("unknown shell %s: custom shells must contain %s", name, scriptPlaceholder)
+	}
+	command, err := splitShellWords(name)
+	if err != nil {
+		return scriptShell{}, fmt.Errorf("split custom shell %s: %w", name, err)
+	}
+	if command[0] == "" || strings.Contains(command[0], scriptPlaceholder) {
+		return scriptShell{}, fmt.Errorf("custom shell %s must start with a command", name)
+	}
+	return scriptShell{command: command}, nil
+}
+
+// args returns the command arguments to run the given script file.
+func (sh scriptShell) args(script string) []string {
+	args := make([]string, len(sh.command))
+	for i, a := range sh.command {
+		args[i] = strings.ReplaceAll(a, scriptPlaceholder, script)
+	}
+	return args
 }
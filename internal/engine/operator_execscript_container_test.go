@@ -0,0 +1,85 @@
+//go:build integration && unix
+
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// testImage returns a locally available image that has bash installed.
+func testImage(t *testing.T, runtime string) string {
+	t.Helper()
+	image := os.Getenv("BULK_TEST_IMAGE")
+	if image == "" {
+		image = "bash:5"
+	}
+	if err := exec.Command(runtime, "image", "inspect", image).Run(); err != nil {
+		t.Skipf("image %s is not available locally: %v", image, err)
+	}
+	return image
+}
+
+func TestOperatorExecScriptContainer(t *testing.T) {
+	op := &OperatorExecScript{}
+	runtime, err := op.runtime()
+	if err != nil {
+		t.Skipf("container runtime not available: %v", err)
+	}
+	image := testImage(t, runtime)
+
+	t.Setenv("BULK_TEST_VALUE", "passed")
+	dir := t.TempDir()
+	op = &OperatorExecScript{
+		Run:     "echo \"$BULK_TEST_VALUE\" > out.txt\n",
+		Image:   image,
+		Runtime: runtime,
+		PassEnv: []string{"BULK_TEST_VALUE"},
+	}
+	if err := op.Validate(); err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	if err := op.Apply(OperatorContext{Dir: dir}); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	p := filepath.Join(dir, "out.txt")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "passed" {
+		t.Errorf("unexpected output: %q", got)
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatalf("failed to stat output: %v", err)
+	}
+	if uid := int(fi.Sys().(*syscall.Stat_t).Uid); uid != os.Getuid() {
+		t.Errorf("unexpected file owner: got %d, want %d", uid, os.Getuid())
+	}
+}
+
+func TestOperatorExecScriptContainerNetwork(t *testing.T) {
+	op := &OperatorExecScript{}
+	runtime, err := op.runtime()
+	if err != nil {
+		t.Skipf("container runtime not available: %v", err)
+	}
+	image := testImage(t, runtime)
+
+	op = &OperatorExecScript{
+		// NOTE: Only the loopback interface should exist without network
+		Run:     "test \"$(ls /sys/class/net)\" = lo\n",
+		Image:   image,
+		Runtime: runtime,
+	}
+	if err := op.Apply(OperatorContext{Dir: t.TempDir()}); err != nil {
+		t.Errorf("expected network to be disabled: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build unix
+
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOperatorExecScriptContainerArgs(t *testing.T) {
+	t.Setenv("BULK_TEST_TOKEN", "secret")
+	user := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	sh := scriptShells["sh"]
+	ctx := OperatorContext{Dir: "/repo", WorkDir: "sub", Env: []string{"FOO=bar"}}
+	cases := []struct {
+		name    string
+		op      OperatorExecScript
+		runtime string
+		want    []string
+	}{
+		{
+			name:    "docker",
+			op:      OperatorExecScript{Image: "bash:5"},
+			runtime: "docker",
+			want: []string{
+				"run", "--rm", "--name", "bulk-test",
+				"--volume", "/repo:/workspace",
+				"--volume", "/tmp/script.sh:/tmp/bulk-script.sh:ro",
+				"--workdir", "/workspace/sub",
+				"--user", user,
+				"--network", "none",
+				"--env", "FOO",
+				"bash:5", "sh", "-e", "/tmp/bulk-script.sh",
+			},
+		},
+		{
+			name:    "podman with network and env",
+			op:      OperatorExecScript{Image: "bash:5", Network: true, PassEnv: []string{"BULK_TEST_TOKEN", "BULK_TEST_UNSET"}},
+			runtime: "podman",
+			want: []string{
+				"run", "--rm", "--name", "bulk-test",
+				"--volume", "/repo:/workspace",
+				"--volume", "/tmp/script.sh:/tmp/bulk-script.sh:ro",
+				"--workdir", "/workspace/sub",
+				"--user", user,
+				"--userns", "keep-id",
+				"--env", "BULK_TEST_TOKEN",
+				"--env", "FOO",
+				"bash:5", "sh", "-e", "/tmp/bulk-script.sh",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.op.containerArgs(ctx, tc.runtime, "bulk-test", sh, "/tmp/script.sh")
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("unexpected args:\ngot  %q\nwant %q", got, tc.want)
+			}
+			// NOTE: Values must not be exposed in the process arguments
+			for _, a := range got {
+				if strings.Contains(a, "secret") || strings.Contains(a, "bar") {
+					t.Errorf("unexpected value in args: %s", a)
+				}
+			}
+		})
+	}
+}
+
+func TestOperatorExecScriptRuntime(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "podman"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("failed to write runtime: %v", err)
+	}
+	cases := []struct {
+		name    string
+		path    string
+		runtime string
+		want    string
+		wantErr bool
+	}{
+		{name: "detected", path: dir, want: "podman"},
+		{name: "specified", path: dir, runtime: "podman", want: "podman"},
+		{name: "specified missing", path: dir, runtime: "docker", wantErr: true},
+		{name: "none", path: t.TempDir(), wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("PATH", tc.path)
+			op := OperatorExecScript{Runtime: tc.runtime}
+			got, err := op.runtime()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("unexpected runtime: got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerOperator("file", (*OperatorFile)(nil))
+}
+
+const (
+	fileActionDelete = "delete"
+	fileActionMove   = "move"
+	fileActionCopy   = "copy"
+	fileActionChmod  = "chmod"
+)
+
+const (
+	fileSourceRepo = "repo"
+	fileSourcePlan = "plan"
+)
+
+// OperatorFile details the file operations to be executed.
+type OperatorFile struct {
+	// File operation to perform on targeted paths.
+	Action string `json:"action" jsonschema:"enum=delete,move,copy,chmod"`
+	// List of file paths to operate on. Accepts Glob expressions including
+	// `**`, and patterns prefixed with `!` are excluded.
+	Target []string `json:"target"`
+	// Root that targets are resolved against. The plan root is only supported
+	// for copies.
+	Source string `json:"source,omitempty" jsonschema:"enum=repo,plan"`
+	// Destination path for moves and copies, relative to the repository root.
+	Destination string `json:"destination,omitempty"`
+	// Octal file mode to apply for chmod.
+	Mode string `json:"mode,omitempty" jsonschema:"pattern=^[0-7]{3,4}$"`
+}
+
+func (op *OperatorFile) targets() []string {
+	// NOTE: Files copied from the plan are not in the repository
+	var targets []string
+	if op.Source != fileSourcePlan {
+		targets = append(targets, op.Target...)
+	}
+	if op.Destination != "" {
+		targets = append(targets, op.Destination)
+	}
+	return targets
+}
+
+func (op *OperatorFile) Validate() error {
+	if len(op.Target) == 0 {
+		return fmt.Errorf("target is not specified")
+	}
+	if err := validateGlobs(op.Target); err != nil {
+		return fmt.Errorf("target is not valid: %w", err)
+	}
+	switch op.Source {
+	case "", fileSourceRepo:
+	case fileSourcePlan:
+		if op.Action != fileActionCopy {
+			return fmt.Errorf("source %s is only supported for %s", op.Source, fileActionCopy)
+		}
+	default:
+		return fmt.Errorf("unknown source: %s", op.Source)
+	}
+	switch op.Action {
+	case fileActionDelete:
+	case fileActionMove, fileActionCopy:
+		if op.Destination == "" {
+			return fmt.Errorf("destination is not specified")
+		}
+		if err := validateRelativePath(op.Destination); err != nil {
+			return fmt.Errorf("destination is not valid: %w", err)
+		}
+	case fileActionChmod:
+		if _, err := op.mode(); err != nil {
+			return fmt.Errorf("mode is not valid: %w", err)
+		}
+	case "":
+		return fmt.Errorf("action is not specified")
+	default:
+		return fmt.Errorf("unknown action: %s", op.Action)
+	}
+	return nil
+}
+
+func (op *OperatorFile) Apply(ctx OperatorContext) error {
+	root := ctx.workPath()
+	if op.Source == fileSourcePlan {
+		root = ctx.PlanDir
+	}
+	paths, err := globPaths(root, op.Target)
+	if err != nil {
+		return fmt.Errorf("resolve target: %w", err)
+	}
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(root) {
+			return fmt.Errorf("refusing to operate on root dir")
+		}
+	}
+
+	switch op.Action {
+	case fileActionDelete:
+		for _, p := range paths {
+			if err := os.RemoveAll(p); err != nil {
+				return fmt.Errorf("delete %s: %w", p, err)
+			}
+		}
+	case fileActionMove, fileActionCopy:
+		if len(paths) == 0 {
+			return nil
+		}
+		dst, err := resolvePath(ctx.workPath(), op.Destination)
+		if err != nil {
+			return fmt.Errorf("resolve destination: %w", err)
+		}
+		// NOTE: Similar to `mv` and `cp`, the destination is treated as a
+		// directory when it already is one, when it ends with a separator, or
+		// when there are multiple sources.
+		intoDir := len(paths) > 1 || strings.HasSuffix(op.Destination, "/")
+		if fi, err := os.Stat(dst); err == nil && fi.IsDir() {
+			intoDir = true
+		}
+		for _, p := range paths {
+			to := dst
+			if intoDir {
+				to = filepath.Join(dst, filepath.Base(p))
+			}
+			if err := ensureWithinDir(ctx.workPath(), to); err != nil {
+				return fmt.Errorf("resolve destination: %w", err)
+			}
+			if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+				return fmt.Errorf("create parent dir: %w", err)
+			}
+			if op.Action == fileActionMove {
+				if err := os.Rename(p, to); err != nil {
+					return fmt.Errorf("move %s: %w", p, err)
+				}
+				continue
+			}
+			if err := copyPath(p, to, ctx.workPath()); err != nil {
+				return fmt.Errorf("copy %s: %w", p, err)
+			}
+		}
+	case fileActionChmod:
+		mode, err := op.mode()
+		if err != nil {
+			return fmt.Errorf("parse mode: %w", err)
+		}
+		for _, p := range paths {
+			if err := os.Chmod(p, mode); err != nil {
+				return fmt.Errorf("chmod %s: %w", p, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action: %s", op.Action)
+	}
+	return nil
+}
+
+func (op *OperatorFile) mode() (fs.FileMode, error) {
+	if op.Mode == "" {
+		return 0, fmt.Errorf("mode is not specified")
+	}
+	m, err := strconv.ParseUint(op.Mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("parse octal: %w", err)
+	}
+	if m > 0777 {
+		return 0, fmt.Errorf("mode %s is out of range", op.Mode)
+	}
+	return fs.FileMode(m), nil
+}
+
+// copyPath copies the file or directory to the destination, which must be
+// within root.
+func copyPath(src, dst, root string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("stat source: %w", err)
+	}
+	// NOTE: Copying a dir into itself would walk the copies as they are
+	// made, and copying a file onto itself would truncate it
+	if err := ensureWithinDir(src, dst); err == nil {
+		return fmt.Errorf("destination %s is within source %s", dst, src)
+	}
+	if !fi.IsDir() {
+		return copyFile(src, dst, fi.Mode().Perm())
+	}
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return fmt.Errorf("relative path: %w", err)
+		}
+		// NOTE: Symlinks already within the destination tree could otherwise
+		// redirect writes outside of the root
+		to := filepath.Join(dst, rel)
+		if err := ensureWithinDir(root, to); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(to, 0755)
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// NOTE: Symlinks are skipped to avoid pulling in files from
+			// outside of the source tree.
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("stat file: %w", err)
+		}
+		return copyFile(p, to, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	// NOTE: Dangling symlinks are not resolved by ensureWithinDir, but would
+	// be followed when the destination is created
+	if fi, err := os.Lstat(dst); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+		return fmt.Errorf("destination %s is a symlink", dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("open destination: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copy contents: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close destination: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles writes the files of the contents under the directory.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+}
+
+// readTestFiles returns the contents of the regular files under the
+// directory by their slash-separated paths.
+func readTestFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to read files: %v", err)
+	}
+	return files
+}
+
+func TestOperatorFileApply(t *testing.T) {
+	cases := []struct {
+		name string
+		op   OperatorFile
+		want map[string]string
+	}{
+		{
+			name: "delete",
+			op:   OperatorFile{Action: "delete", Target: []string{"docs/**/*.md", "!docs/keep.md"}},
+			want: map[string]string{"a.txt": "a", "docs/keep.md": "k"},
+		},
+		{
+			name: "move",
+			op:   OperatorFile{Action: "move", Target: []string{"a.txt"}, Destination: "b.txt"},
+			want: map[string]string{"b.txt": "a", "docs/keep.md": "k", "docs/old/x.md": "x"},
+		},
+		{
+			name: "move into dir",
+			op:   OperatorFile{Action: "move", Target: []string{"a.txt"}, Destination: "docs/"},
+			want: map[string]string{"docs/a.txt": "a", "docs/keep.md": "k", "docs/old/x.md": "x"},
+		},
+		{
+			name: "copy dir",
+			op:   OperatorFile{Action: "copy", Target: []string{"docs"}, Destination: "out/docs"},
+			want: map[string]string{"a.txt": "a", "docs/keep.md": "k", "docs/old/x.md": "x", "out/docs/keep.md": "k", "out/docs/old/x.md": "x"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{"a.txt": "a", "docs/keep.md": "k", "docs/old/x.md": "x"})
+			if err := tc.op.Validate(); err != nil {
+				t.Fatalf("invalid operator: %v", err)
+			}
+			if err := tc.op.Apply(OperatorContext{Dir: dir}); err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+			got := readTestFiles(t, dir)
+			if len(got) != len(tc.want) {
+				t.Errorf("unexpected files: got %v, want %v", got, tc.want)
+			}
+			for name, content := range tc.want {
+				if got[name] != content {
+					t.Errorf("unexpected file %s: got %q, want %q", name, got[name], content)
+				}
+			}
+		})
+	}
+}
+
+func TestOperatorFileCopyIntoSource(t *testing.T) {
+	for name, op := range map[string]OperatorFile{
+		"dir":       {Action: "copy", Target: []string{"docs"}, Destination: "docs/backup"},
+		"into dir":  {Action: "copy", Target: []string{"docs"}, Destination: "docs/"},
+		"same file": {Action: "copy", Target: []string{"a.txt"}, Destination: "a.txt"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{"a.txt": "a", "docs/keep.md": "k"}
+			writeTestFiles(t, dir, files)
+			if err := op.Apply(OperatorContext{Dir: dir}); err == nil || !strings.Contains(err.Error(), "is within source") {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := readTestFiles(t, dir); !maps.Equal(got, files) {
+				t.Errorf("unexpected files: got %v, want %v", got, files)
+			}
+		})
+	}
+}
+
+func TestOperatorFileChmod(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"run.sh": "#!/bin/sh\n"})
+	op := OperatorFile{Action: "chmod", Target: []string{"*.sh"}, Mode: "755"}
+	if err := op.Apply(OperatorContext{Dir: dir}); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "run.sh"))
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+	if got := fi.Mode().Perm(); got != 0755 {
+		t.Errorf("unexpected mode: got %o, want 755", got)
+	}
+}
+
+func TestOperatorFileEscape(t *testing.T) {
+	for name, op := range map[string]OperatorFile{
+		"target":      {Action: "delete", Target: []string{"../a.txt"}},
+		"destination": {Action: "copy", Target: []string{"a.txt"}, Destination: "../a.txt"},
+	} {
+		t.Run("validate "+name, func(t *testing.T) {
+			if err := op.Validate(); err == nil {
+				t.Errorf("expected error for path escaping the repo")
+			}
+		})
+	}
+
+	cases := []struct {
+		name     string
+		link     string // Path of the symlink to the outside dir
+		op       OperatorFile
+		dangling bool // Whether the symlink points to a missing file
+	}{
+		{
+			name: "target symlink",
+			link: "out",
+			op:   OperatorFile{Action: "chmod", Target: []string{"out/*"}, Mode: "777"},
+		},
+		{
+			name: "destination symlink",
+			link: "out",
+			op:   OperatorFile{Action: "copy", Target: []string{"a.txt"}, Destination: "out/a.txt"},
+		},
+		{
+			name: "symlink within destination tree",
+			link: "dst/src/sub",
+			op:   OperatorFile{Action: "copy", Target: []string{"src"}, Destination: "dst"},
+		},
+		{
+			name:     "dangling symlink destination",
+			link:     "a.md",
+			op:       OperatorFile{Action: "copy", Target: []string{"a.txt"}, Destination: "a.md"},
+			dangling: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, outside := t.TempDir(), t.TempDir()
+			writeTestFiles(t, dir, map[string]string{"a.txt": "a", "src/sub/a.txt": "a", "dst/src/.keep": ""})
+			writeTestFiles(t, outside, map[string]string{"keep.txt": "k"})
+			target := outside
+			if tc.dangling {
+				target = filepath.Join(outside, "missing.txt")
+			}
+			if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(tc.link))); err != nil {
+				t.Fatalf("failed to create symlink: %v", err)
+			}
+			if err := tc.op.Apply(OperatorContext{Dir: dir}); err == nil {
+				t.Errorf("expected error for path escaping the repo")
+			}
+			got := readTestFiles(t, outside)
+			if len(got) != 1 || got["keep.txt"] != "k" {
+				t.Errorf("unexpected files outside of the repo: %v", got)
+			}
+			fi, err := os.Stat(filepath.Join(outside, "keep.txt"))
+			if err != nil || fi.Mode().Perm() != 0644 {
+				t.Errorf("unexpected file outside of the repo: %v, %v", fi, err)
+			}
+		})
+	}
+}
+
+func TestOperatorFileRootDir(t *testing.T) {
+	dir := t.TempDir()
+	op := OperatorFile{Action: "delete", Target: []string{"."}}
+	if err := op.Apply(OperatorContext{Dir: dir}); err == nil || !strings.Contains(err.Error(), "root dir") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+func init() {
+	registerOperator("gorewrite", (*OperatorGoRewrite)(nil))
+}
+
+// goRewriteArrow separates the pattern and replacement of a rewrite rule.
+const goRewriteArrow = "->"
+
+// OperatorGoRewrite details the Go syntax tree rewrites to be executed.
+type OperatorGoRewrite struct {
+	// List of Go files to operate on. Accepts Glob expressions including
+	// `**`, and patterns prefixed with `!` are excluded.
+	Target []string `json:"target"`
+	// Whether to skip files ignored by the repository's gitignore rules.
+	Gitignore bool `json:"gitignore,omitempty"`
+	// List of rewrite rules of the form `pattern -> replacement`, as accepted
+	// by `gofmt -r`.
+	Rules []string `json:"rules,omitempty" jsonschema:"pattern=->"`
+	// List of imports to add to the targeted files that reference them.
+	// Blank imports are added to every targeted file, and dot imports are not
+	// supported as their use cannot be detected.
+	AddImports []GoImport `json:"addImports,omitempty"`
+	// List of imports to remove.
+	RemoveImports []GoImport `json:"removeImports,omitempty"`
+	// List of import paths to rename.
+	RenameImports []GoImportRename `json:"renameImports,omitempty"`
+}
+
+type GoImport struct {
+	// Import path of the package.
+	Path string `json:"path"`
+	// Local name of the import, if any.
+	Name string `json:"name,omitempty"`
+}
+
+type GoImportRename struct {
+	// Import path to rename.
+	From string `json:"from"`
+	// New import path.
+	To string `json:"to"`
+}
+
+func (op *OperatorGoRewrite) targets() []string {
+	return op.Target
+}
+
+func (op *OperatorGoRewrite) Validate() error {
+	if len(op.Target) == 0 {
+		return fmt.Errorf("target is not specified")
+	}
+	if err := validateGlobs(op.Target); err != nil {
+		return fmt.Errorf("target is not valid: %w", err)
+	}
+	if len(op.Rules) == 0 && len(op.AddImports) == 0 && len(op.RemoveImports) == 0 && len(op.RenameImports) == 0 {
+		return fmt.Errorf("no rules or import changes specified")
+	}
+	for i, r := range op.Rules {
+		if _, _, err := parseGoRewriteRule(r); err != nil {
+			return fmt.Errorf("rules.%d is not valid: %w", i, err)
+		}
+	}
+	for i, imp := range op.AddImports {
+		if err := imp.validate(); err != nil {
+			return fmt.Errorf("addImports.%d is not valid: %w", i, err)
+		}
+		if imp.Name == "." {
+			return fmt.Errorf("addImports.%d is not valid: dot imports cannot be added", i)
+		}
+	}
+	for i, imp := range op.RemoveImports {
+		if err := imp.validate(); err != nil {
+			return fmt.Errorf("removeImports.%d is not valid: %w", i, err)
+		}
+	}
+	for i, r := range op.RenameImports {
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("renameImports.%d must specify both from and to", i)
+		}
+	}
+	return nil
+}
+
+func (op *OperatorGoRewrite) Apply(ctx OperatorContext) error {
+	paths, err := globTextFiles(ctx, op.Target, op.Gitignore)
+	if err != nil {
+		return fmt.Errorf("resolve target: %w", err)
+	}
+
+	type rule struct{ pattern, replace ast.Expr }
+	rules := make([]rule, 0, len(op.Rules))
+	for _, r := range op.Rules {
+		pattern, replace, err := parseGoRewriteRule(r)
+		if err != nil {
+			return fmt.Errorf("parse rule: %w", err)
+		}
+		rules = append(rules, rule{pattern, replace})
+	}
+
+	// NOTE: All files are parsed before any of them are rewritten so that
+	// every file that fails to parse can be reported at once.
+	fset := token.NewFileSet()
+	files := make(map[string]*ast.File)
+	sources := make(map[string][]byte)
+	var errs []error
+	for _, p := range paths {
+		if !strings.HasSuffix(p, ".go") {
+			continue
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read file %s: %w", p, err)
+		}
+		f, err := parser.ParseFile(fset, p, b, parser.ParseComments)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		files[p], sources[p] = f, b
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("parse go files: %w", errors.Join(errs...))
+	}
+
+	for p, f := range files {
+		// NOTE: Files are only written if they are changed, as formatting
+		// alone would add unrelated changes
+		changed := false
+		for _, r := range rules {
+			var matched bool
+			f, matched = rewriteGoFile(fset, r.pattern, r.replace, f)
+			changed = changed || matched
+		}
+		for _, r := range op.RenameImports {
+			changed = astutil.RewriteImport(fset, f, r.From, r.To) || changed
+		}
+		for _, imp := range op.RemoveImports {
+			changed = astutil.DeleteNamedImport(fset, f, imp.Name, imp.Path) || changed
+		}
+		for _, imp := range op.AddImports {
+			// NOTE: Imports that are not used would fail to compile, while
+			// blank imports are only imported for their side effects
+			if imp.Name == "_" || referencesGoPackage(f, imp.packageName()) {
+				changed = astutil.AddNamedImport(fset, f, imp.Name, imp.Path) || changed
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, f); err != nil {
+			return fmt.Errorf("format file %s: %w", p, err)
+		}
+		if bytes.Equal(buf.Bytes(), sources[p]) {
+			continue
+		}
+		// NOTE: Permissions are only used when creating file so it is
+		// not used in this case because the file should already exist.
+		if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write file: %w", err)
+		}
+	}
+	return nil
+}
+
+// referencesGoPackage reports whether the file refers to a package of the
+// name in a selector, e.g. name.Func.
+func referencesGoPackage(f *ast.File, name string) bool {
+	found := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			// NOTE: Identifiers that resolve to an object are local
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == name && id.Obj == nil {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// packageName returns the name that the import is referred to by, which is
+// assumed from the last element of its path when it has no name, ignoring
+// major version suffixes, e.g. yaml for gopkg.in/yaml.v3.
+func (imp GoImport) packageName() string {
+	if imp.Name != "" {
+		return imp.Name
+	}
+	base := path.Base(imp.Path)
+	if v, ok := strings.CutPrefix(base, "v"); ok {
+		if _, err := strconv.Atoi(v); err == nil && path.Dir(imp.Path) != "." {
+			base = path.Base(path.Dir(imp.Path))
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+func (imp GoImport) validate() error {
+	if imp.Path == "" {
+		return fmt.Errorf("path is not specified")
+	}
+	if strings.ContainsAny(imp.Path, " \t\n\"`\\") {
+		return fmt.Errorf("path %s is not a valid import path", imp.Path)
+	}
+	if imp.Name != "" && imp.Name != "_" && imp.Name != "." && !token.IsIdentifier(imp.Name) {
+		return fmt.Errorf("name %s is not a valid identifier", imp.Name)
+	}
+	return nil
+}
+
+// parseGoRewriteRule parses a rule of the form `pattern -> replacement`, the
+// same as accepted by `gofmt -r`.
+func parseGoRewriteRule(rule string) (pattern, replace ast.Expr, err error) {
+	f := strings.Split(rule, goRewriteArrow)
+	if len(f) != 2 {
+		return nil, nil, fmt.Errorf("rule must be of the form 'pattern %s replacement'", goRewriteArrow)
+	}
+	if pattern, err = parser.ParseExpr(strings.TrimSpace(f[0])); err != nil {
+		return nil, nil, fmt.Errorf("parse pattern: %w", err)
+	}
+	if replace, err = parser.ParseExpr(strings.TrimSpace(f[1])); err != nil {
+		return nil, nil, fmt.Errorf("parse replacement: %w", err)
+	}
+	return pattern, replace, nil
+}
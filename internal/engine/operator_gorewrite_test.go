@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOperatorGoRewriteApply(t *testing.T) {
+	cases := []struct {
+		name string
+		op   OperatorGoRewrite
+		src  string
+		want string
+	}{
+		{
+			name: "rule",
+			op:   OperatorGoRewrite{Rules: []string{"strings.Replace(s, o, n, -1) -> strings.ReplaceAll(s, o, n)"}},
+			src:  "package p\n\nimport \"strings\"\n\nvar v = strings.Replace(\"a\", \"a\", \"b\", -1)\n",
+			want: "package p\n\nimport \"strings\"\n\nvar v = strings.ReplaceAll(\"a\", \"a\", \"b\")\n",
+		},
+		{
+			name: "repeated wildcard",
+			op:   OperatorGoRewrite{Rules: []string{"x == x -> true"}},
+			src:  "package p\n\nvar a, b = 1 == 1, 1 == 2\n",
+			want: "package p\n\nvar a, b = true, 1 == 2\n",
+		},
+		{
+			name: "rule without match is not formatted",
+			op:   OperatorGoRewrite{Rules: []string{"x == x -> true"}},
+			src:  "package p\nvar  a = 1 == 2\n",
+			want: "package p\nvar  a = 1 == 2\n",
+		},
+		{
+			name: "add referenced import",
+			op: OperatorGoRewrite{
+				Rules:      []string{"errors.Wrap(e, m) -> fmt.Errorf(m+\": %w\", e)"},
+				AddImports: []GoImport{{Path: "fmt"}},
+			},
+			src:  "package p\n\nfunc f(e error) error {\n\treturn errors.Wrap(e, \"f\")\n}\n",
+			want: "package p\n\nimport \"fmt\"\n\nfunc f(e error) error {\n\treturn fmt.Errorf(\"f\"+\": %w\", e)\n}\n",
+		},
+		{
+			name: "add unreferenced import",
+			op:   OperatorGoRewrite{AddImports: []GoImport{{Path: "fmt"}}},
+			src:  "package p\n\nvar v = 1\n",
+			want: "package p\n\nvar v = 1\n",
+		},
+		{
+			name: "add versioned import",
+			op:   OperatorGoRewrite{AddImports: []GoImport{{Path: "gopkg.in/yaml.v3"}}},
+			src:  "package p\n\nvar v = yaml.Marshal\n",
+			want: "package p\n\nimport \"gopkg.in/yaml.v3\"\n\nvar v = yaml.Marshal\n",
+		},
+		{
+			name: "add blank import",
+			op:   OperatorGoRewrite{AddImports: []GoImport{{Path: "embed", Name: "_"}}},
+			src:  "package p\n\nvar v = 1\n",
+			want: "package p\n\nimport _ \"embed\"\n\nvar v = 1\n",
+		},
+		{
+			name: "remove import",
+			op:   OperatorGoRewrite{RemoveImports: []GoImport{{Path: "os"}}},
+			src:  "package p\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nvar v = fmt.Sprint\n",
+			want: "package p\n\nimport (\n\t\"fmt\"\n)\n\nvar v = fmt.Sprint\n",
+		},
+		{
+			name: "rename import",
+			op:   OperatorGoRewrite{RenameImports: []GoImportRename{{From: "github.com/pkg/errors", To: "errors"}}},
+			src:  "package p\n\nimport \"github.com/pkg/errors\"\n\nvar v = errors.New\n",
+			want: "package p\n\nimport \"errors\"\n\nvar v = errors.New\n",
+		},
+		{
+			name: "rename missing import",
+			op:   OperatorGoRewrite{RenameImports: []GoImportRename{{From: "github.com/pkg/errors", To: "errors"}}},
+			src:  "package p\nimport \"fmt\"\nvar  v = fmt.Sprint\n",
+			want: "package p\nimport \"fmt\"\nvar  v = fmt.Sprint\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := filepath.Join(dir, "p.go")
+			if err := os.WriteFile(p, []byte(tc.src), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			tc.op.Target = []string{"*.go"}
+			if err := tc.op.Validate(); err != nil {
+				t.Fatalf("invalid operator: %v", err)
+			}
+			if err := tc.op.Apply(OperatorContext{Dir: dir}); err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatalf("failed to read file: %v", err)
+			}
+			if got := string(b); got != tc.want {
+				t.Errorf("unexpected file:\ngot  %q\nwant %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOperatorGoRewriteValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		op   OperatorGoRewrite
+		err  string
+	}{
+		{"dot import", OperatorGoRewrite{AddImports: []GoImport{{Path: "fmt", Name: "."}}}, "dot imports cannot be added"},
+		{"invalid name", OperatorGoRewrite{AddImports: []GoImport{{Path: "fmt", Name: "1x"}}}, "not a valid identifier"},
+		{"no changes", OperatorGoRewrite{}, "no rules or import changes"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.op.Target = []string{"*.go"}
+			if err := tc.op.Validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("unexpected error: got %v, want %q", err, tc.err)
+			}
+		})
+	}
+
+	// NOTE: Dot imports can still be removed
+	op := OperatorGoRewrite{Target: []string{"*.go"}, RemoveImports: []GoImport{{Path: "fmt", Name: "."}}}
+	if err := op.Validate(); err != nil {
+		t.Errorf("unexpected error for removed dot import: %v", err)
+	}
+}
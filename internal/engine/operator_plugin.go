@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	registerOperator("plugin", (*OperatorPlugin)(nil))
+}
+
+// pluginPrefix is the prefix of plugin executables.
+const pluginPrefix = "bulk-op-"
+
+// pluginPathEnv is the environment variable listing the dirs that are
+// searched for plugins before PATH.
+const pluginPathEnv = "BULK_PLUGIN_PATH"
+
+// pluginProtocolVersion is the version of the plugin protocol.
+const pluginProtocolVersion = 1
+
+const (
+	pluginMethodValidate = "validate"
+	pluginMethodApply    = "apply"
+)
+
+const (
+	pluginSeverityError   = "error"
+	pluginSeverityWarning = "warning"
+	pluginSeverityInfo    = "info"
+)
+
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// OperatorPlugin details the external plugin to be executed. Runs the
+// `bulk-op-<name>` executable from BULK_PLUGIN_PATH or PATH.
+type OperatorPlugin struct {
+	// Name of the plugin.
+	Name string `json:"name" jsonschema:"pattern=^[a-z0-9][a-z0-9-]*$"`
+	// Configuration passed to the plugin.
+	With any `json:"with,omitempty"`
+}
+
+// PluginRequest is written as JSON to the stdin of the plugin.
+type PluginRequest struct {
+	Version    int               `json:"version"`
+	Method     string            `json:"method"`
+	Config     any               `json:"config"`
+	Dir        string            `json:"dir,omitempty"`
+	WorkDir    string            `json:"workDir,omitempty"`
+	PlanDir    string            `json:"planDir,omitempty"`
+	Repository RepositoryContext `json:"repository"`
+}
+
+// PluginResponse is read as JSON from the stdout of the plugin.
+type PluginResponse struct {
+	Diagnostics []PluginDiagnostic `json:"diagnostics"`
+}
+
+type PluginDiagnostic struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+func (d PluginDiagnostic) String() string {
+	var loc []string
+	if d.File != "" {
+		loc = append(loc, d.File)
+		if d.Line > 0 {
+			loc = append(loc, fmt.Sprint(d.Line))
+			if d.Column > 0 {
+				loc = append(loc, fmt.Sprint(d.Column))
+			}
+		}
+	}
+	if len(loc) == 0 {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", strings.Join(loc, ":"), d.Severity, d.Message)
+}
+
+func (op *OperatorPlugin) Validate() error {
+	if op.Name == "" {
+		return fmt.Errorf("name is not specified")
+	}
+	if !pluginNamePattern.MatchString(op.Name) {
+		return fmt.Errorf("name %s must only contain lowercase letters, digits and dashes", op.Name)
+	}
+	req := PluginRequest{
+		Version: pluginProtocolVersion,
+		Method:  pluginMethodValidate,
+		Config:  op.With,
+	}
+	return op.call(context.Background(), "", nil, req)
+}
+
+func (op *OperatorPlugin) Apply(ctx OperatorContext) error {
+	req := PluginRequest{
+		Version:    pluginProtocolVersion,
+		Method:     pluginMethodApply,
+		Config:     op.With,
+		Dir:        ctx.Dir,
+		WorkDir:    ctx.WorkDir,
+		PlanDir:    ctx.PlanDir,
+		Repository: ctx.Template.Repository,
+	}
+	return op.call(ctx.context(), ctx.workPath(), ctx.Env, req)
+}
+
+// call runs the plugin with the request and returns an error if the plugin
+// fails or reports any error diagnostics.
+func (op *OperatorPlugin) call(ctx context.Context, dir string, env []string, req PluginRequest) error {
+	bin, err := lookPlugin(op.Name)
+	if err != nil {
+		return fmt.Errorf("find plugin: %w", err)
+	}
+
+	in, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, bin)
+	c.Dir = dir
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+	c.Stdin = bytes.NewReader(in)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		if o := strings.TrimSpace(stderr.String()); o != "" {
+			fmt.Fprintln(os.Stderr, o)
+		}
+		return fmt.Errorf("run plugin %s: %w", op.Name, err)
+	}
+
+	var resp PluginResponse
+	if strings.TrimSpace(stdout.String()) != "" {
+		if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+
+	var errs []error
+	for _, d := range resp.Diagnostics {
+		switch d.Severity {
+		case pluginSeverityError:
+			errs = append(errs, errors.New(d.String()))
+		case pluginSeverityWarning, pluginSeverityInfo:
+			fmt.Fprintf(os.Stderr, "%s%s: %s\n", pluginPrefix, op.Name, d)
+		default:
+			errs = append(errs, fmt.Errorf("unknown diagnostic severity %q: %s", d.Severity, d.Message))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("plugin %s %s: %w", op.Name, req.Method, errors.Join(errs...))
+	}
+	return nil
+}
+
+// lookPlugin finds the executable of the named plugin, searching the dirs in
+// BULK_PLUGIN_PATH before PATH.
+func lookPlugin(name string) (string, error) {
+	bin := pluginPrefix + name
+	for _, dir := range filepath.SplitList(os.Getenv(pluginPathEnv)) {
+		if dir == "" {
+			continue
+		}
+		p := filepath.Join(dir, bin)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() && fi.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return exec.LookPath(bin)
+}
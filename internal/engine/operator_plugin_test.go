@@ -0,0 +1,161 @@
+//go:build unix
+
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// NOTE: The plugin records its request and prints the response of the test
+const testPlugin = `#!/bin/sh
+cat > "$BULK_TEST_REQUEST"
+pwd > "$BULK_TEST_REQUEST.pwd"
+printf '%s' "$BULK_TEST_RESPONSE"
+exit "${BULK_TEST_EXIT:-0}"
+`
+
+// setupTestPlugin installs the test plugin as bulk-op-test on the plugin
+// path, and returns the path of the file that its request is written to.
+func setupTestPlugin(t *testing.T) string {
+	t.Helper()
+	// NOTE: Files that are not executable are skipped by the lookup
+	shadowed, dir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(shadowed, "bulk-op-test"), []byte("not executable"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bulk-op-test"), []byte(testPlugin), 0755); err != nil {
+		t.Fatalf("failed to write plugin: %v", err)
+	}
+	t.Setenv(pluginPathEnv, strings.Join([]string{shadowed, dir}, string(os.PathListSeparator)))
+	req := filepath.Join(t.TempDir(), "request.json")
+	t.Setenv("BULK_TEST_REQUEST", req)
+	t.Setenv("BULK_TEST_RESPONSE", "")
+	return req
+}
+
+// readTestRequest returns the request that the test plugin received.
+func readTestRequest(t *testing.T, name string) PluginRequest {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("failed to read request: %v", err)
+	}
+	var req PluginRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	return req
+}
+
+func TestOperatorPluginValidate(t *testing.T) {
+	name := setupTestPlugin(t)
+	op := OperatorPlugin{Name: "test", With: map[string]any{"option": "value"}}
+	if err := op.Validate(); err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	req := readTestRequest(t, name)
+	if req.Version != pluginProtocolVersion || req.Method != pluginMethodValidate {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if c, _ := req.Config.(map[string]any); c["option"] != "value" {
+		t.Errorf("unexpected config: %v", req.Config)
+	}
+
+	op = OperatorPlugin{Name: "missing"}
+	if err := op.Validate(); err == nil || !strings.Contains(err.Error(), "find plugin") {
+		t.Errorf("unexpected error for missing plugin: %v", err)
+	}
+}
+
+func TestOperatorPluginApply(t *testing.T) {
+	name := setupTestPlugin(t)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"sub/.keep": ""})
+	op := OperatorPlugin{Name: "test"}
+	ctx := OperatorContext{
+		Dir:     dir,
+		WorkDir: "sub",
+		PlanDir: "/plans",
+		Template: TemplateContext{
+			Repository: NewRepositoryContext("owner/repo"),
+		},
+	}
+	if err := op.Apply(ctx); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	req := readTestRequest(t, name)
+	if req.Method != pluginMethodApply || req.Dir != dir || req.WorkDir != "sub" || req.PlanDir != "/plans" || req.Repository.Name != "owner/repo" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	pwd, err := os.ReadFile(name + ".pwd")
+	if err != nil {
+		t.Fatalf("failed to read working dir: %v", err)
+	}
+	want, _ := filepath.EvalSymlinks(filepath.Join(dir, "sub"))
+	if got, _ := filepath.EvalSymlinks(strings.TrimSpace(string(pwd))); got != want {
+		t.Errorf("unexpected working dir: got %s, want %s", got, want)
+	}
+}
+
+func TestOperatorPluginDiagnostics(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		exit     string
+		err      string
+	}{
+		{
+			name:     "no diagnostics",
+			response: `{"diagnostics": []}`,
+		},
+		{
+			name: "empty response",
+		},
+		{
+			name:     "warning",
+			response: `{"diagnostics": [{"severity": "warning", "message": "deprecated"}]}`,
+		},
+		{
+			name:     "error",
+			response: `{"diagnostics": [{"severity": "error", "message": "bad option", "file": "a.go", "line": 1, "column": 2}]}`,
+			err:      "a.go:1:2: error: bad option",
+		},
+		{
+			name:     "unknown severity",
+			response: `{"diagnostics": [{"severity": "fatal", "message": "bad"}]}`,
+			err:      `unknown diagnostic severity "fatal"`,
+		},
+		{
+			name:     "invalid response",
+			response: `not json`,
+			err:      "decode response",
+		},
+		{
+			name: "exit code",
+			exit: "3",
+			err:  "run plugin test",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestPlugin(t)
+			t.Setenv("BULK_TEST_RESPONSE", tc.response)
+			t.Setenv("BULK_TEST_EXIT", tc.exit)
+			op := OperatorPlugin{Name: "test"}
+			err := op.Validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("unexpected error: got %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
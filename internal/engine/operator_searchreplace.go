@@ -4,56 +4,68 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
+	"strings"
 )
 
-var _ Operator = (*OperatorSearchReplace)(nil)
+func init() {
+	registerOperator("editor", (*OperatorSearchReplace)(nil))
+}
 
+// OperatorSearchReplace details the editing steps to be executed.
 type OperatorSearchReplace struct {
-	Target       []string                `json:"target"`
+	// List of file paths to operate on. Accepts Glob expressions including
+	// `**`, and patterns prefixed with `!` are excluded.
+	Target []string `json:"target"`
+	// Whether to skip files ignored by the repository's gitignore rules.
+	Gitignore bool `json:"gitignore,omitempty"`
+	// List of replacement operations to run on targeted files.
 	Replacements []StepEditorReplacement `json:"replacements"`
 }
 
+func (op *OperatorSearchReplace) targets() []string {
+	return op.Target
+}
+
 func (op *OperatorSearchReplace) Validate() error {
 	if len(op.Target) == 0 {
 		return fmt.Errorf("target is not specified")
 	}
+	if err := validateGlobs(op.Target); err != nil {
+		return fmt.Errorf("target is not valid: %w", err)
+	}
 	if len(op.Replacements) == 0 {
 		return fmt.Errorf("replacements is not specified")
 	}
 	for i, r := range op.Replacements {
-		if _, err := regexp.Compile(r.Search); err != nil {
-			return fmt.Errorf("replacements.%d.search is not a valid regex: %w", i, err)
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("replacements.%d is not valid: %w", i, err)
 		}
 	}
 	return nil
 }
 
 func (op *OperatorSearchReplace) Apply(ctx OperatorContext) error {
-	// TODO: Support excludes/negation?
-	paths := make([]string, 0)
-	for _, glob := range op.Target {
-		m, err := filepath.Glob(filepath.Join(ctx.Dir, glob))
-		if err != nil {
-			return fmt.Errorf("glob match '%s': %w", glob, err)
-		}
-		paths = append(paths, m...)
+	paths, err := globTextFiles(ctx, op.Target, op.Gitignore)
+	if err != nil {
+		return fmt.Errorf("resolve target: %w", err)
 	}
 
-	for _, r := range op.Replacements {
-		re, err := regexp.Compile(r.Search)
+	for i, r := range op.Replacements {
+		re, err := r.regexp()
 		if err != nil {
 			return fmt.Errorf("compile regex: %w", err)
 		}
 
+		matched := 0
 		for _, p := range paths {
 			b, err := os.ReadFile(p)
 			if err != nil {
 				return fmt.Errorf("read file %s: %w", p, err)
 			}
 
-			out := re.ReplaceAll(b, []byte(r.Replace))
+			out, n := r.replace(re, b)
+			matched += n
 			if bytes.Equal(b, out) {
 				continue
 			}
@@ -64,6 +76,87 @@ func (op *OperatorSearchReplace) Apply(ctx OperatorContext) error {
 				return fmt.Errorf("write file: %w", err)
 			}
 		}
+
+		if err := r.Expect.check(matched); err != nil {
+			return fmt.Errorf("replacements.%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *StepEditorReplacement) validate() error {
+	if strings.Trim(r.Flags, "ims") != "" {
+		return fmt.Errorf("flags %s must only contain i, m or s", r.Flags)
+	}
+	if _, err := r.regexp(); err != nil {
+		return fmt.Errorf("search is not a valid regex: %w", err)
+	}
+	if r.Count < 0 {
+		return fmt.Errorf("count must not be negative")
+	}
+	if e := r.Expect; e != nil {
+		if e.Min != nil && *e.Min < 0 {
+			return fmt.Errorf("expect.min must not be negative")
+		}
+		if e.Max != nil && *e.Max < 0 {
+			return fmt.Errorf("expect.max must not be negative")
+		}
+		if e.Min != nil && e.Max != nil && *e.Min > *e.Max {
+			return fmt.Errorf("expect.min must not exceed expect.max")
+		}
+	}
+	return nil
+}
+
+func (r *StepEditorReplacement) regexp() (*regexp.Regexp, error) {
+	expr := r.Search
+	if r.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if r.Flags != "" {
+		expr = fmt.Sprintf("(?%s)%s", r.Flags, expr)
+	}
+	return regexp.Compile(expr)
+}
+
+// replace replaces up to Count matches in b, or all of them if Count is zero,
+// and returns the output along with the total number of matches in b.
+func (r *StepEditorReplacement) replace(re *regexp.Regexp, b []byte) ([]byte, int) {
+	matches := re.FindAllSubmatchIndex(b, -1)
+	if len(matches) == 0 {
+		return b, 0
+	}
+
+	out := make([]byte, 0, len(b))
+	last := 0
+	for i, m := range matches {
+		if r.Count > 0 && i >= r.Count {
+			break
+		}
+		out = append(out, b[last:m[0]]...)
+		if r.Literal {
+			// NOTE: Literal replacements do not expand `$1`-style references
+			out = append(out, r.Replace...)
+		} else {
+			out = re.Expand(out, []byte(r.Replace), b, m)
+		}
+		last = m[1]
+	}
+	out = append(out, b[last:]...)
+	return out, len(matches)
+}
+
+// check returns an error if the number of matches across the target files
+// does not meet the expectation.
+func (e *StepEditorReplacementExpect) check(matched int) error {
+	if e == nil {
+		return nil
+	}
+	if e.Min != nil && matched < *e.Min {
+		return fmt.Errorf("matched %d times, expected at least %d", matched, *e.Min)
+	}
+	if e.Max != nil && matched > *e.Max {
+		return fmt.Errorf("matched %d times, expected at most %d", matched, *e.Max)
 	}
 	return nil
 }
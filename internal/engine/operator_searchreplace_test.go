@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOperatorSearchReplaceApply(t *testing.T) {
+	one := 1
+	cases := []struct {
+		name string
+		r    StepEditorReplacement
+		src  string
+		want string
+		err  string
+	}{
+		{
+			name: "regexp",
+			r:    StepEditorReplacement{Search: `go (\d+)\.\d+`, Replace: "go $1.24"},
+			src:  "go 1.22\n",
+			want: "go 1.24\n",
+		},
+		{
+			name: "literal",
+			r:    StepEditorReplacement{Search: "a.b*(c)", Replace: "x", Literal: true},
+			src:  "a.b*(c) aXbbc\n",
+			want: "x aXbbc\n",
+		},
+		{
+			name: "literal without expansion",
+			r:    StepEditorReplacement{Search: "(a)", Replace: "$1-${1}", Literal: true},
+			src:  "(a) a\n",
+			want: "$1-${1} a\n",
+		},
+		{
+			name: "case-insensitive",
+			r:    StepEditorReplacement{Search: "foo", Replace: "bar", Flags: "i"},
+			src:  "Foo FOO foo\n",
+			want: "bar bar bar\n",
+		},
+		{
+			name: "multiline",
+			r:    StepEditorReplacement{Search: "^b$", Replace: "x", Flags: "m"},
+			src:  "a\nb\nc\n",
+			want: "a\nx\nc\n",
+		},
+		{
+			name: "single line",
+			r:    StepEditorReplacement{Search: "^b$", Replace: "x"},
+			src:  "a\nb\nc\n",
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "count",
+			r:    StepEditorReplacement{Search: "a", Replace: "b", Count: 2},
+			src:  "aaaa\n",
+			want: "bbaa\n",
+		},
+		{
+			name: "expect",
+			r:    StepEditorReplacement{Search: "a", Replace: "b", Expect: &StepEditorReplacementExpect{Min: &one, Max: &one}},
+			src:  "a\n",
+			want: "b\n",
+		},
+		{
+			name: "expect too few",
+			r:    StepEditorReplacement{Search: "z", Replace: "b", Expect: &StepEditorReplacementExpect{Min: &one}},
+			src:  "a\n",
+			err:  "expected at least 1",
+		},
+		{
+			name: "expect too many",
+			r:    StepEditorReplacement{Search: "a", Replace: "b", Count: 1, Expect: &StepEditorReplacementExpect{Max: &one}},
+			src:  "aa\n",
+			err:  "matched 2 times, expected at most 1",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := filepath.Join(dir, "f")
+			if err := os.WriteFile(p, []byte(tc.src), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			op := OperatorSearchReplace{Target: []string{"f"}, Replacements: []StepEditorReplacement{tc.r}}
+			if err := op.Validate(); err != nil {
+				t.Fatalf("invalid operator: %v", err)
+			}
+			err := op.Apply(OperatorContext{Dir: dir})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("unexpected error: got %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatalf("failed to read file: %v", err)
+			}
+			if got := string(b); got != tc.want {
+				t.Errorf("unexpected file:\ngot  %q\nwant %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOperatorSearchReplaceValidate(t *testing.T) {
+	one, two := 1, 2
+	cases := []struct {
+		name string
+		r    StepEditorReplacement
+		err  string
+	}{
+		{"flags", StepEditorReplacement{Search: "a", Flags: "x"}, "must only contain"},
+		{"regexp", StepEditorReplacement{Search: "("}, "not a valid regex"},
+		{"count", StepEditorReplacement{Search: "a", Count: -1}, "count must not be negative"},
+		{"expect", StepEditorReplacement{Search: "a", Expect: &StepEditorReplacementExpect{Min: &two, Max: &one}}, "must not exceed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			op := OperatorSearchReplace{Target: []string{"f"}, Replacements: []StepEditorReplacement{tc.r}}
+			if err := op.Validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("unexpected error: got %v, want %q", err, tc.err)
+			}
+		})
+	}
+
+	// NOTE: Regex metacharacters are valid in literal mode
+	op := OperatorSearchReplace{Target: []string{"f"}, Replacements: []StepEditorReplacement{{Search: "(", Literal: true}}}
+	if err := op.Validate(); err != nil {
+		t.Errorf("unexpected error for literal: %v", err)
+	}
+}
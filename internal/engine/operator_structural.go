@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+)
+
+func init() {
+	registerOperator("structural", (*OperatorStructural)(nil))
+}
+
+// OperatorStructural details the structural search and replace to be
+// executed.
+type OperatorStructural struct {
+	// List of file paths to operate on. Accepts Glob expressions including
+	// `**`, and patterns prefixed with `!` are excluded.
+	Target []string `json:"target"`
+	// Whether to skip files ignored by the repository's gitignore rules.
+	Gitignore bool `json:"gitignore,omitempty"`
+	// Language of the targeted files. Inferred from the file extension if
+	// unspecified.
+	Language string `json:"language,omitempty"`
+	// List of structural rewrite rules to run on targeted files.
+	Rules []StructuralRule `json:"rules"`
+}
+
+type StructuralRule struct {
+	// Match template where `:[name]` holes match balanced text and
+	// `:[[name]]` holes match identifiers.
+	Match string `json:"match"`
+	// Rewrite template that may reuse holes from the match template.
+	Rewrite string `json:"rewrite"`
+}
+
+// NOTE: Languages are listed from the supported syntaxes
+func (*OperatorStructural) extendSchema(g *schemaGenerator, s *jsonSchema) {
+	s.Properties.get("language").Enum = slices.Sorted(maps.Keys(structuralLanguages))
+}
+
+func (op *OperatorStructural) targets() []string {
+	return op.Target
+}
+
+func (op *OperatorStructural) Validate() error {
+	if len(op.Target) == 0 {
+		return fmt.Errorf("target is not specified")
+	}
+	if err := validateGlobs(op.Target); err != nil {
+		return fmt.Errorf("target is not valid: %w", err)
+	}
+	if op.Language != "" {
+		if _, ok := structuralLanguages[op.Language]; !ok {
+			return fmt.Errorf("unknown language: %s", op.Language)
+		}
+	}
+	if len(op.Rules) == 0 {
+		return fmt.Errorf("rules is not specified")
+	}
+	for i, r := range op.Rules {
+		p, err := parseStructuralPattern(r.Match)
+		if err != nil {
+			return fmt.Errorf("rules.%d.match is not valid: %w", i, err)
+		}
+		rw, err := parseStructuralPattern(r.Rewrite)
+		if err != nil && r.Rewrite != "" {
+			return fmt.Errorf("rules.%d.rewrite is not valid: %w", i, err)
+		}
+		if rw == nil {
+			continue
+		}
+		for name := range rw.holes {
+			if _, ok := p.holes[name]; !ok {
+				return fmt.Errorf("rules.%d.rewrite uses hole %s that is not in match", i, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (op *OperatorStructural) Apply(ctx OperatorContext) error {
+	paths, err := globTextFiles(ctx, op.Target, op.Gitignore)
+	if err != nil {
+		return fmt.Errorf("resolve target: %w", err)
+	}
+
+	patterns := make([]*structuralPattern, 0, len(op.Rules))
+	for _, r := range op.Rules {
+		p, err := parseStructuralPattern(r.Match)
+		if err != nil {
+			return fmt.Errorf("parse pattern: %w", err)
+		}
+		patterns = append(patterns, p)
+	}
+
+	for _, p := range paths {
+		lang := op.Language
+		if lang == "" {
+			lang = structuralLanguageOf(p)
+		}
+		syn := structuralLanguages[lang]
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read file %s: %w", p, err)
+		}
+		out := string(b)
+		for i, r := range op.Rules {
+			out = structuralReplaceAll(out, syn, patterns[i], r.Rewrite)
+		}
+		if out == string(b) {
+			continue
+		}
+
+		// NOTE: Permissions are only used when creating file so it is
+		// not used in this case because the file should already exist.
+		if err := os.WriteFile(p, []byte(out), 0644); err != nil {
+			return fmt.Errorf("write file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental/sysfs"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+func init() {
+	registerOperator("wasm", (*OperatorWasm)(nil))
+}
+
+// wasmWorkDir is the path that the worktree is mounted at within the module.
+const wasmWorkDir = "/"
+
+// wasmPageSize is the size of a WebAssembly memory page in bytes.
+const wasmPageSize = 64 * 1024
+
+const (
+	wasmDefaultTimeLimit   = time.Minute
+	wasmDefaultMemoryLimit = 256 // MiB
+)
+
+// OperatorWasm details the WebAssembly module to be executed. The module runs
+// under WASI with only the repository worktree mounted at `/`, without its Git
+// directory. Symlinks can neither be created nor traversed by the module.
+type OperatorWasm struct {
+	// Path to the WASI module, relative to the plan.
+	Module string `json:"module"`
+	// Arguments passed to the module.
+	Args []string `json:"args,omitempty"`
+	// Maximum duration of the module, e.g. 30s or 5m. Defaults to 1m.
+	TimeLimit string `json:"timeLimit,omitempty"`
+	// Maximum memory of the module in MiB. Defaults to 256.
+	MemoryLimit int `json:"memoryLimit,omitempty" jsonschema:"minimum=0;maximum=4096"`
+}
+
+func (op *OperatorWasm) Validate() error {
+	if op.Module == "" {
+		return fmt.Errorf("module is not specified")
+	}
+	if err := validateRelativePath(op.Module); err != nil {
+		return fmt.Errorf("module is not valid: %w", err)
+	}
+	if _, err := op.timeLimit(); err != nil {
+		return fmt.Errorf("timeLimit is not valid: %w", err)
+	}
+	if op.MemoryLimit < 0 {
+		return fmt.Errorf("memoryLimit must not be negative")
+	}
+	// NOTE: Memory is limited to 65536 pages of 64KiB, i.e. 4GiB
+	if op.MemoryLimit > 4096 {
+		return fmt.Errorf("memoryLimit must not exceed 4096 MiB")
+	}
+	return nil
+}
+
+func (op *OperatorWasm) Apply(ctx OperatorContext) error {
+	p, err := resolvePath(ctx.PlanDir, op.Module)
+	if err != nil {
+		return fmt.Errorf("resolve module: %w", err)
+	}
+	code, err := os.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("read module: %w", err)
+	}
+
+	limit, err := op.timeLimit()
+	if err != nil {
+		return fmt.Errorf("get time limit: %w", err)
+	}
+	c, cancel := context.WithTimeout(ctx.context(), limit)
+	defer cancel()
+
+	memory := uint64(op.MemoryLimit)
+	if memory == 0 {
+		memory = wasmDefaultMemoryLimit
+	}
+	cfg := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(memory * 1024 * 1024 / wasmPageSize)).
+		WithCloseOnContextDone(true)
+	r := wazero.NewRuntimeWithConfig(c, cfg)
+	defer r.Close(context.Background())
+
+	if _, err := wasi_snapshot_preview1.Instantiate(c, r); err != nil {
+		return fmt.Errorf("instantiate wasi: %w", err)
+	}
+	compiled, err := r.CompileModule(c, code)
+	if err != nil {
+		return fmt.Errorf("compile module: %w", err)
+	}
+
+	// NOTE: Only the worktree is made available to the module, and the host
+	// environment is not inherited apart from the variables of the step.
+	fsc := wazero.NewFSConfig().(sysfs.FSConfig).WithSysFSMount(newWasmFS(ctx.Dir), wasmWorkDir)
+	wd := path.Join(wasmWorkDir, filepath.ToSlash(ctx.WorkDir))
+	mcfg := wazero.NewModuleConfig().
+		WithName(filepath.Base(op.Module)).
+		WithArgs(append([]string{filepath.Base(op.Module)}, op.Args...)...).
+		WithFSConfig(fsc).
+		WithEnv("PWD", wd).
+		WithStdout(os.Stdout).
+		WithStderr(os.Stderr).
+		WithSysWalltime().
+		WithSysNanotime()
+	for _, kv := range ctx.Env {
+		k, v, _ := strings.Cut(kv, "=")
+		mcfg = mcfg.WithEnv(k, v)
+	}
+
+	if _, err := r.InstantiateModule(c, compiled, mcfg); err != nil {
+		var e *sys.ExitError
+		if errors.As(err, &e) && e.ExitCode() == 0 {
+			return nil
+		}
+		if errors.Is(c.Err(), context.DeadlineExceeded) && ctx.context().Err() == nil {
+			return fmt.Errorf("module exceeded time limit of %s: %w", limit, err)
+		}
+		return fmt.Errorf("run module: %w", err)
+	}
+	return nil
+}
+
+func (op *OperatorWasm) timeLimit() (time.Duration, error) {
+	if op.TimeLimit == "" {
+		return wasmDefaultTimeLimit, nil
+	}
+	d, err := time.ParseDuration(op.TimeLimit)
+	if err != nil {
+		return 0, fmt.Errorf("parse duration: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %s must be positive", op.TimeLimit)
+	}
+	return d, nil
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testWasmModule builds a module into the directory that runs the operation
+// of its arguments on the paths of the worktree:
+//
+//	write <path> <content>
+//	read <path>
+//	symlink <target> <path>
+//	list <dir>, which writes the names of its entries to list.txt
+func testWasmModule(t *testing.T, dir string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not available")
+	}
+	src := t.TempDir()
+	writeTestFiles(t, src, map[string]string{
+		"go.mod": "module wasmtest\n\ngo 1.21\n",
+		"main.go": `package main
+
+import (
+	"os"
+	"strings"
+)
+
+func main() {
+	var err error
+	switch args := os.Args[1:]; args[0] {
+	case "write":
+		err = os.WriteFile(args[1], []byte(args[2]), 0644)
+	case "read":
+		_, err = os.ReadFile(args[1])
+	case "symlink":
+		err = os.Symlink(args[1], args[2])
+	case "list":
+		var entries []os.DirEntry
+		if entries, err = os.ReadDir(args[1]); err == nil {
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			err = os.WriteFile("list.txt", []byte(strings.Join(names, "\n")), 0644)
+		}
+	}
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+	}
+}
+`,
+	})
+	c := exec.Command("go", "build", "-o", filepath.Join(dir, "m.wasm"), ".")
+	c.Dir = src
+	c.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GOWORK=off")
+	if o, err := c.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build module: %v: %s", err, o)
+	}
+	return "m.wasm"
+}
+
+func TestOperatorWasmApply(t *testing.T) {
+	planDir, dir := t.TempDir(), t.TempDir()
+	op := OperatorWasm{Module: testWasmModule(t, planDir), Args: []string{"write", "out.txt", "hello"}}
+	if err := op.Validate(); err != nil {
+		t.Fatalf("invalid operator: %v", err)
+	}
+	writeTestFiles(t, dir, map[string]string{"sub/.keep": ""})
+	if err := op.Apply(OperatorContext{Dir: dir, WorkDir: "sub", PlanDir: planDir}); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "sub", "out.txt"))
+	if err != nil || string(b) != "hello" {
+		t.Errorf("unexpected output: %q, %v", b, err)
+	}
+}
+
+func TestOperatorWasmSandbox(t *testing.T) {
+	planDir := t.TempDir()
+	module := testWasmModule(t, planDir)
+	cases := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "write git config", args: []string{"write", "/.git/config", "x"}, wantErr: true},
+		{name: "write git hook", args: []string{"write", "sub/../.git/hooks/pre-commit", "x"}, wantErr: true},
+		{name: "read git config", args: []string{"read", ".git/config"}, wantErr: true},
+		{name: "create symlink", args: []string{"symlink", "sub", "new"}, wantErr: true},
+		{name: "write through symlink", args: []string{"write", "out/a.txt", "x"}, wantErr: true},
+		{name: "read through symlink", args: []string{"read", "out/keep.txt"}, wantErr: true},
+		{name: "read through symlink within worktree", args: []string{"read", "in/.keep"}, wantErr: true},
+		{name: "read file", args: []string{"read", "sub/.keep"}, wantErr: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dir, outside := t.TempDir(), t.TempDir()
+			writeTestFiles(t, dir, map[string]string{"sub/.keep": "", ".git/config": "c", ".git/hooks/.keep": ""})
+			writeTestFiles(t, outside, map[string]string{"keep.txt": "k"})
+			for link, target := range map[string]string{"out": outside, "in": "sub"} {
+				if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+					t.Fatalf("failed to create symlink: %v", err)
+				}
+			}
+			op := OperatorWasm{Module: module, Args: tc.args}
+			err := op.Apply(OperatorContext{Dir: dir, PlanDir: planDir})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := readTestFiles(t, filepath.Join(dir, ".git")); len(got) != 2 || got["config"] != "c" {
+				t.Errorf("unexpected git dir: %v", got)
+			}
+			if got := readTestFiles(t, outside); len(got) != 1 || got["keep.txt"] != "k" {
+				t.Errorf("unexpected files outside of the worktree: %v", got)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "new")); err == nil {
+				t.Errorf("symlink was created")
+			}
+		})
+	}
+
+	t.Run("list root", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFiles(t, dir, map[string]string{"a.txt": "a", ".git/config": "c"})
+		op := OperatorWasm{Module: module, Args: []string{"list", "/"}}
+		if err := op.Apply(OperatorContext{Dir: dir, PlanDir: planDir}); err != nil {
+			t.Fatalf("failed to apply: %v", err)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "list.txt"))
+		if err != nil {
+			t.Fatalf("failed to read list: %v", err)
+		}
+		if got := strings.Fields(string(b)); len(got) != 1 || got[0] != "a.txt" {
+			t.Errorf("unexpected entries: %v", got)
+		}
+	})
+}
@@ -1,92 +1,633 @@
 package engine
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 type Plan struct {
-	Version int    `json:"version"`
-	ID      string `json:"id"`
-	On      On     `json:"on"`
-	Steps   []Step `json:"steps"`
-	Commit  Commit `json:"commit"`
+	// Version of the configuration schema.
+	Version int `json:"version" jsonschema:"minimum=0"`
+	// Unique identifier of the plan, which names the branches that it pushes.
+	// Derived from a hash of the steps and commit if omitted.
+	ID string `json:"id,omitempty"`
+	// Path of a base plan, relative to this plan, that this plan is merged
+	// onto. Objects are merged by key, where null removes the key, arrays are
+	// appended and other values are replaced.
+	Extends string `json:"extends,omitempty"`
+	// Repositories targeted for the bulk changes.
+	On On `json:"on"`
+	// Files of the target repositories that are checked out.
+	Checkout Checkout `json:"checkout,omitzero"`
+	// List of steps to run on the target repository.
+	Steps []Step `json:"steps"`
+	// Details used to create the Git commit and pull request.
+	Commit Commit `json:"commit"`
+
+	// NOTE: Whether the id is derived, which is only known once decoded
+	derivedID bool
+}
+
+// deriveID sets the id of the plan from a hash of its steps and commit if it
+// does not have one. The steps and commit must not be injected yet.
+func (p *Plan) deriveID() error {
+	if p.ID != "" {
+		return nil
+	}
+	// NOTE: Steps are encoded with sorted keys, so the encoding is stable
+	// across formatting and field order
+	b, err := json.Marshal(struct {
+		Steps  []Step `json:"steps"`
+		Commit Commit `json:"commit"`
+	}{p.Steps, p.Commit})
+	if err != nil {
+		return fmt.Errorf("encode plan: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	p.ID = hex.EncodeToString(sum[:16])
+	p.derivedID = true
+	return nil
+}
+
+// validatePlanID checks that the id is a valid component of a Git ref, as it
+// names the branches of the plan by default.
+func validatePlanID(id string) error {
+	if strings.Contains(id, "/") {
+		return fmt.Errorf("id %q must not contain '/'", id)
+	}
+	if err := validateRefComponent(id); err != nil {
+		return fmt.Errorf("id %q %w", id, err)
+	}
+	return nil
+}
+
+// validateBranchName checks that the name is a valid Git branch name.
+func validateBranchName(name string) error {
+	for _, c := range strings.Split(name, "/") {
+		if err := validateRefComponent(c); err != nil {
+			return fmt.Errorf("branch %q %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateRefComponent checks that the name is a valid component of a Git
+// ref, following the rules of git check-ref-format.
+func validateRefComponent(name string) error {
+	switch {
+	case name == "":
+		return errors.New("must not have empty components")
+	case name == "@":
+		return errors.New("must not be @")
+	case strings.HasPrefix(name, "."), strings.HasSuffix(name, "."):
+		return errors.New("must not start or end with a dot")
+	case strings.HasSuffix(name, ".lock"):
+		return errors.New("must not end with .lock")
+	case strings.Contains(name, ".."), strings.Contains(name, "@{"):
+		return errors.New("must not contain .. or @{")
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("must not contain %q", r)
+		}
+	}
+	return nil
+}
+
+// NOTE: Plans extending a base plan only specify what they change
+func (*Plan) extendSchema(g *schemaGenerator, s *jsonSchema) {
+	s.If = &jsonSchema{Required: []string{extendsKey}}
+	s.Else = &jsonSchema{Required: s.Required}
+	s.Required = nil
 }
 
 type On struct {
-	Repositories      []string          `json:"repositories"`
-	RepositoriesMatch RepositoriesMatch `json:"repositoriesMatch"`
+	// List of repositories in the owner/repo form.
+	Repositories []string `json:"repositories,omitempty" jsonschema:"pattern=^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$"`
+	// Search for repositories containing matching code.
+	RepositoriesMatch RepositoriesMatch `json:"repositoriesMatch,omitzero"`
+	// Predicates evaluated after cloning. Repositories not satisfying all of
+	// them are filtered out.
+	Where []Condition `json:"where,omitempty"`
 }
 
 type RepositoriesMatch struct {
-	Search    string   `json:"search"`
-	Extension string   `json:"extension"`
-	Filename  string   `json:"filename"`
-	Language  string   `json:"language"`
-	Owners    []string `json:"owners"`
-	Repos     []string `json:"repos"`
-	Size      string   `json:"size"`
+	// Code search query.
+	Search string `json:"search,omitempty"`
+	// Extension of the files containing matching code.
+	Extension string `json:"extension,omitempty"`
+	// Name of the files containing matching code.
+	Filename string `json:"filename,omitempty"`
+	// Language of the files containing matching code.
+	Language string `json:"language,omitempty"`
+	// Owners of the repositories to search.
+	Owners []string `json:"owners,omitempty" jsonschema:"pattern=^[A-Za-z0-9-]+$"`
+	// Repositories to search in the owner/repo form.
+	Repos []string `json:"repos,omitempty" jsonschema:"pattern=^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$"`
+	// Size of the files containing matching code, e.g. >1000.
+	Size string `json:"size,omitempty"`
 }
 
 type Step struct {
-	ExecScript    *OperatorExecScript    `json:"script,omitempty"`
-	SearchReplace *OperatorSearchReplace `json:"editor,omitempty"`
+	// Condition for the step to be applied.
+	If *Condition `json:"if,omitempty"`
+	// Environment variables set for the step.
+	Env map[string]string `json:"env,omitempty" jsonschema:"pattern=^[A-Za-z_][A-Za-z0-9_]*$"`
+	// Working directory of the step, relative to the repository root.
+	WorkingDirectory string `json:"workingDirectory,omitempty"`
+	// Maximum duration of the step, e.g. 30s or 5m.
+	Timeout string `json:"timeout,omitempty"`
+
+	// NOTE: The operator is decoded from the single remaining key of the
+	// step, which must be registered with registerOperator.
+	Operator Operator `json:"-"`
+}
+
+// stepFields are the keys of a step that are not operators.
+var stepFields = []string{"if", "env", "workingDirectory", "timeout"}
+
+func (s *Step) UnmarshalJSON(b []byte) error {
+	// NOTE: Alias type prevents infinite recursion into this method
+	type step Step
+	var v step
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	var keys []string
+	for k := range m {
+		if !slices.Contains(stepFields, k) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	switch len(keys) {
+	case 0:
+		return fmt.Errorf("no operator defined in step, expected one of: %s", strings.Join(operatorKeys(), ", "))
+	case 1:
+	default:
+		return fmt.Errorf("multiple operators defined in a single step: %s", strings.Join(keys, ", "))
+	}
+	spec, ok := operators[keys[0]]
+	if !ok {
+		return fmt.Errorf("unknown operator %q in step, expected one of: %s", keys[0], strings.Join(operatorKeys(), ", "))
+	}
+	op := spec.new()
+	if err := json.Unmarshal(m[spec.key], op); err != nil {
+		return fmt.Errorf("decode %s: %w", spec.key, err)
+	}
+	*s = Step(v)
+	s.Operator = op
+	return nil
+}
+
+func (s *Step) UnmarshalYAML(b []byte) error {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return err
+	}
+	return s.UnmarshalJSON(j)
+}
+
+func (s Step) MarshalJSON() ([]byte, error) {
+	type step Step
+	b, err := json.Marshal(step(s))
+	if err != nil {
+		return nil, err
+	}
+	if s.Operator == nil {
+		return b, nil
+	}
+	key, err := s.Key()
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if m[key], err = json.Marshal(s.Operator); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// NOTE: Exactly one of the registered operators, or an include of a step
+// fragment, must be specified
+func (*Step) extendSchema(g *schemaGenerator, s *jsonSchema) {
+	s.Properties = append(s.Properties, schemaProperty{Name: includeKey, Schema: &jsonSchema{
+		Type:        "string",
+		Description: "Path of a file holding a list of steps, relative to this file, that replace this step. Cannot be combined with other fields.",
+	}})
+	s.OneOf = append(s.OneOf, &jsonSchema{Required: []string{includeKey}})
+	for _, key := range operatorKeys() {
+		spec := operators[key]
+		op := g.object(spec.typ)
+		op.Description = g.typeDoc(spec.typ)
+		s.Properties = append(s.Properties, schemaProperty{Name: key, Schema: op})
+		s.OneOf = append(s.OneOf, &jsonSchema{Required: []string{key}})
+	}
+}
+
+// Key returns the key of the operator of the step, e.g. script.
+func (s *Step) Key() (string, error) {
+	if s.Operator == nil {
+		return "", fmt.Errorf("no operator defined in step")
+	}
+	key, ok := operatorKeyOf(s.Operator)
+	if !ok {
+		return "", fmt.Errorf("operator %T is not registered", s.Operator)
+	}
+	return key, nil
+}
+
+func (s *Step) Validate() error {
+	if s.If != nil {
+		if err := s.If.Validate(); err != nil {
+			return fmt.Errorf("if is not valid: %w", err)
+		}
+	}
+	for k := range s.Env {
+		if !envNamePattern.MatchString(k) {
+			return fmt.Errorf("env.%s is not a valid variable name", k)
+		}
+	}
+	if err := validateRelativePath(s.WorkingDirectory); err != nil {
+		return fmt.Errorf("workingDirectory is not valid: %w", err)
+	}
+	if _, err := s.GetTimeout(); err != nil {
+		return fmt.Errorf("timeout is not valid: %w", err)
+	}
+	key, err := s.Key()
+	if err != nil {
+		return fmt.Errorf("get operator: %w", err)
+	}
+	if err := s.Operator.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
 }
 
-func (s *Step) GetOperator() (Operator, error) {
-	// Ensure that only one operator is defined per step
-	if s.ExecScript != nil && s.SearchReplace != nil {
-		return nil, fmt.Errorf("multiple operators defined in a single step")
+// GetTimeout returns the timeout of the step, or zero if there is none.
+func (s *Step) GetTimeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
 	}
-	if s.ExecScript != nil {
-		return s.ExecScript, nil
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("parse duration: %w", err)
 	}
-	if s.SearchReplace != nil {
-		return s.SearchReplace, nil
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %s must be positive", s.Timeout)
 	}
-	return nil, fmt.Errorf("unknown operator")
+	return d, nil
+}
+
+// GetEnv returns the environment variables of the step in KEY=VALUE form.
+func (s *Step) GetEnv() []string {
+	env := make([]string, 0, len(s.Env))
+	for _, k := range slices.Sorted(maps.Keys(s.Env)) {
+		env = append(env, fmt.Sprintf("%s=%s", k, s.Env[k]))
+	}
+	return env
 }
 
 type StepEditorReplacement struct {
-	Search  string `json:"search"`
+	// Search term in regular expression, or literal text if literal is set.
+	Search string `json:"search"`
+	// Replacement text. Supports `$1`-style expansions unless literal is set.
 	Replace string `json:"replace"`
+	// Whether search and replace are treated as literal text.
+	Literal bool `json:"literal,omitempty"`
+	// Regular expression flags: i (case-insensitive), m (multiline) and s
+	// (dot matches newline).
+	Flags string `json:"flags,omitempty" jsonschema:"pattern=^[ims]*$"`
+	// Maximum number of replacements per file. Replaces all matches if zero.
+	Count int `json:"count,omitempty" jsonschema:"minimum=0"`
+	// Expected number of matches across all targeted files. The repository
+	// fails if unmet.
+	Expect *StepEditorReplacementExpect `json:"expect,omitempty"`
+}
+
+type StepEditorReplacementExpect struct {
+	// Minimum number of matches.
+	Min *int `json:"min,omitempty" jsonschema:"minimum=0"`
+	// Maximum number of matches.
+	Max *int `json:"max,omitempty" jsonschema:"minimum=0"`
 }
 
 type Commit struct {
+	// Title of the Git commit, rendered as a template for each repository.
 	Title string `json:"title"`
-	Body  string `json:"body"`
+	// Body of the Git commit, rendered as a template for each repository.
+	Body string `json:"body"`
+	// Branch that the commit is pushed to, rendered as a template for each
+	// repository. Defaults to bulk/{{ .Plan.ID }}.
+	Branch string `json:"branch,omitempty"`
+	// Author of the Git commit. Defaults to the configured Git identity.
+	Author *CommitIdentity `json:"author,omitempty"`
+	// Committer of the Git commit. Defaults to the author if specified, or
+	// the configured Git identity otherwise.
+	Committer *CommitIdentity `json:"committer,omitempty"`
+	// Trailers added to the Git commit after the Idempotency-Key trailer.
+	Trailers []CommitTrailer `json:"trailers,omitempty"`
+	// Signing of the Git commit. Defaults to the configured Git signing.
+	Signing *CommitSigning `json:"signing,omitempty"`
 }
 
-func (p *Plan) Inject(data TemplateContext) error {
-	var err error
-	if p.Commit.Title, err = data.RenderString(p.Commit.Title); err != nil {
-		return fmt.Errorf("inject commit.title: %w", err)
-	}
-	if p.Commit.Body, err = data.RenderString(p.Commit.Body); err != nil {
-		return fmt.Errorf("inject commit.body: %w", err)
-	}
-	if p.Steps != nil {
-		for i, step := range p.Steps {
-			if step.ExecScript != nil {
-				if p.Steps[i].ExecScript.Run, err = data.RenderString(step.ExecScript.Run); err != nil {
-					return fmt.Errorf("inject steps.%d.script.run: %w", i, err)
-				}
-			}
+type CommitIdentity struct {
+	// Name of the identity.
+	Name string `json:"name"`
+	// Email address of the identity.
+	Email string `json:"email"`
+}
+
+type CommitTrailer struct {
+	// Key of the trailer, e.g. Co-authored-by.
+	Key string `json:"key" jsonschema:"pattern=^[A-Za-z0-9-]+$"`
+	// Value of the trailer, rendered as a template for each repository.
+	Value string `json:"value"`
+}
+
+// idempotencyKeyTrailer is the key of the trailer holding the plan id, which
+// is always added to commits.
+const idempotencyKeyTrailer = "Idempotency-Key"
+
+// trailerKeyPattern matches the keys of commit trailers.
+var trailerKeyPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// ParseCommitIdentity parses an identity of the form `Name <email>`.
+func ParseCommitIdentity(s string) (*CommitIdentity, error) {
+	name, rest, ok := strings.Cut(s, "<")
+	email, tail, ok2 := strings.Cut(rest, ">")
+	if !ok || !ok2 || strings.TrimSpace(tail) != "" {
+		return nil, fmt.Errorf("identity %q is not of the form Name <email>", s)
+	}
+	id := &CommitIdentity{Name: strings.TrimSpace(name), Email: strings.TrimSpace(email)}
+	if err := id.Validate(); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (id *CommitIdentity) Validate() error {
+	if id.Name == "" || id.Email == "" {
+		return fmt.Errorf("name and email must be specified")
+	}
+	if strings.ContainsAny(id.Name, "<>\n") || strings.ContainsAny(id.Email, "<>\n") {
+		return fmt.Errorf("name and email must not contain <, > or newlines")
+	}
+	return nil
+}
+
+// String returns the identity in the form `Name <email>`.
+func (id *CommitIdentity) String() string {
+	return fmt.Sprintf("%s <%s>", id.Name, id.Email)
+}
+
+// ParseCommitTrailer parses a trailer of the form `Key: value`.
+func ParseCommitTrailer(s string) (CommitTrailer, error) {
+	k, v, ok := strings.Cut(s, ":")
+	if !ok {
+		return CommitTrailer{}, fmt.Errorf("trailer %q is not of the form Key: value", s)
+	}
+	t := CommitTrailer{Key: strings.TrimSpace(k), Value: strings.TrimSpace(v)}
+	if err := t.Validate(); err != nil {
+		return CommitTrailer{}, err
+	}
+	return t, nil
+}
+
+func (t *CommitTrailer) Validate() error {
+	if !trailerKeyPattern.MatchString(t.Key) {
+		return fmt.Errorf("key %q must only contain letters, digits and hyphens", t.Key)
+	}
+	if strings.EqualFold(t.Key, idempotencyKeyTrailer) {
+		return fmt.Errorf("key %s is reserved", idempotencyKeyTrailer)
+	}
+	if strings.Contains(t.Value, "\n") {
+		return fmt.Errorf("value of %s must not contain newlines", t.Key)
+	}
+	return nil
+}
+
+func (c *Commit) Validate() error {
+	// NOTE: Templated branches are only known for each repository
+	if c.Branch != "" && !strings.Contains(c.Branch, "{{") {
+		if err := validateBranchName(c.Branch); err != nil {
+			return fmt.Errorf("branch is not valid: %w", err)
+		}
+	}
+	if c.Author != nil {
+		if err := c.Author.Validate(); err != nil {
+			return fmt.Errorf("author is not valid: %w", err)
+		}
+	}
+	if c.Committer != nil {
+		if err := c.Committer.Validate(); err != nil {
+			return fmt.Errorf("committer is not valid: %w", err)
+		}
+	}
+	for i, t := range c.Trailers {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("trailers.%d is not valid: %w", i, err)
+		}
+	}
+	if c.Signing != nil {
+		if err := c.Signing.Validate(); err != nil {
+			return fmt.Errorf("signing is not valid: %w", err)
 		}
 	}
 	return nil
 }
 
+// forRepository returns the commit with its title, body, branch and trailers
+// rendered for the repository of the template context.
+func (c Commit) forRepository(tc TemplateContext) (Commit, error) {
+	var err error
+	if c.Title, err = tc.RenderString(c.Title); err != nil {
+		return Commit{}, fmt.Errorf("render title: %w", err)
+	}
+	if c.Body, err = tc.RenderString(c.Body); err != nil {
+		return Commit{}, fmt.Errorf("render body: %w", err)
+	}
+	branch := c.Branch
+	if branch == "" {
+		branch = "bulk/{{ .Plan.ID }}"
+	}
+	if c.Branch, err = tc.RenderString(branch); err != nil {
+		return Commit{}, fmt.Errorf("render branch: %w", err)
+	}
+	if err := validateBranchName(c.Branch); err != nil {
+		return Commit{}, err
+	}
+	c.Trailers = slices.Clone(c.Trailers)
+	for i, t := range c.Trailers {
+		if c.Trailers[i].Value, err = tc.RenderString(t.Value); err != nil {
+			return Commit{}, fmt.Errorf("render trailers.%d: %w", i, err)
+		}
+		if err := c.Trailers[i].Validate(); err != nil {
+			return Commit{}, fmt.Errorf("trailers.%d is not valid: %w", i, err)
+		}
+	}
+	return c, nil
+}
+
+// stepsForRepository returns copies of the steps with the template fields of
+// their operators rendered for the repository of the template context.
+func stepsForRepository(steps []Step, tc TemplateContext) ([]Step, error) {
+	steps = slices.Clone(steps)
+	for i := range steps {
+		key, err := steps[i].Key()
+		if err != nil {
+			return nil, fmt.Errorf("steps.%d: %w", i, err)
+		}
+		steps[i].Operator = operators[key].clone(steps[i].Operator)
+	}
+	fields, err := stepTemplateFields(steps)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		v, err := tc.RenderString(*f.value)
+		if err != nil {
+			return nil, fmt.Errorf("render %s: %w", f.path, err)
+		}
+		*f.value = v
+	}
+	return steps, nil
+}
+
+// templateField is a field of the plan that is rendered as a template for
+// each repository.
+type templateField struct {
+	path  string  // Dot-separated path to the field, e.g. commit.title
+	value *string // Value of the field
+}
+
+// templateFields returns the fields of the plan that are rendered as templates
+// for each repository.
+func (p *Plan) templateFields() ([]templateField, error) {
+	fields := []templateField{
+		{path: "commit.title", value: &p.Commit.Title},
+		{path: "commit.body", value: &p.Commit.Body},
+		{path: "commit.branch", value: &p.Commit.Branch},
+	}
+	for i := range p.Commit.Trailers {
+		fields = append(fields, templateField{
+			path:  fmt.Sprintf("commit.trailers.%d.value", i),
+			value: &p.Commit.Trailers[i].Value,
+		})
+	}
+	steps, err := stepTemplateFields(p.Steps)
+	if err != nil {
+		return nil, err
+	}
+	return append(fields, steps...), nil
+}
+
+// stepTemplateFields returns the fields of the operators of the steps that are
+// rendered as templates.
+func stepTemplateFields(steps []Step) ([]templateField, error) {
+	var fields []templateField
+	for i, step := range steps {
+		key, err := step.Key()
+		if err != nil {
+			return nil, fmt.Errorf("steps.%d: %w", i, err)
+		}
+		spec := operators[key]
+		for _, name := range spec.templates {
+			fields = append(fields, templateField{
+				path:  fmt.Sprintf("steps.%d.%s.%s", i, key, name),
+				value: spec.field(step.Operator, name).Addr().Interface().(*string),
+			})
+		}
+	}
+	return fields, nil
+}
+
+const (
+	planFormatJSON = "json"
+	planFormatYAML = "yaml"
+)
+
+// planFormat returns the format of the plan from the extension of its name, or
+// by sniffing its content if the extension is not known.
+func planFormat(name string, b []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return planFormatJSON
+	case ".yml", ".yaml":
+		return planFormatYAML
+	}
+	// NOTE: JSON documents are objects while YAML documents rarely start with
+	// a flow mapping
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '{' {
+		return planFormatJSON
+	}
+	return planFormatYAML
+}
+
+// readPlanFile reads the plan file, or stdin if the name is -.
+func readPlanFile(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// NewPlansFromFile decodes the plans in the file, which is read from stdin if
+// the name is -. JSON files hold a single plan while YAML files may hold
+// several plans as separate documents. References to other files are resolved
+// relative to the file, or the working directory for stdin.
+func NewPlansFromFile(name string) ([]*Plan, error) {
+	b, err := readPlanFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	dir := "."
+	var stack []string
+	if name != "-" {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return nil, fmt.Errorf("get absolute path: %w", err)
+		}
+		dir, stack = filepath.Dir(abs), []string{abs}
+	}
+	return decodePlans(b, planFormat(name, b), dir, stack)
+}
+
 func NewPlanFromJSON(r io.Reader) (*Plan, error) {
-	var p Plan
-	if err := json.NewDecoder(r).Decode(&p); err != nil {
-		return nil, fmt.Errorf("decode json: %w", err)
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read json: %w", err)
+	}
+	plans, err := decodePlans(b, planFormatJSON, ".", nil)
+	if err != nil {
+		return nil, err
 	}
-	return &p, nil
+	return plans[0], nil
 }
 
 func NewPlanFromJSONFile(name string) (*Plan, error) {
@@ -98,12 +639,24 @@ func NewPlanFromJSONFile(name string) (*Plan, error) {
 	return NewPlanFromJSON(f)
 }
 
+// NewPlansFromYAML decodes each document of the YAML stream as a plan.
+func NewPlansFromYAML(r io.Reader) ([]*Plan, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read yaml: %w", err)
+	}
+	return decodePlans(b, planFormatYAML, ".", nil)
+}
+
 func NewPlanFromYAML(r io.Reader) (*Plan, error) {
-	var p Plan
-	if err := yaml.NewDecoder(r).Decode(&p); err != nil {
-		return nil, fmt.Errorf("decode yaml: %w", err)
+	plans, err := NewPlansFromYAML(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) > 1 {
+		return nil, fmt.Errorf("expected a single plan but found %d", len(plans))
 	}
-	return &p, nil
+	return plans[0], nil
 }
 
 func NewPlanFromYAMLFile(name string) (*Plan, error) {
@@ -114,3 +667,117 @@ func NewPlanFromYAMLFile(name string) (*Plan, error) {
 	defer f.Close()
 	return NewPlanFromYAML(f)
 }
+
+// yamlDocuments returns the bodies of the non-empty documents in the file.
+func yamlDocuments(file *ast.File) []ast.Node {
+	var docs []ast.Node
+	for _, doc := range file.Docs {
+		if doc.Body != nil {
+			docs = append(docs, doc.Body)
+		}
+	}
+	return docs
+}
+
+// yamlNodeToJSON returns the value of the node as decoded from JSON.
+func yamlNodeToJSON(node ast.Node) (any, error) {
+	var v any
+	if err := yaml.NodeToValue(node, &v); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.UnmarshalJSON(bytes.NewReader(b))
+}
+
+// decodePlans decodes the plans in the content of the format. References to
+// other files are resolved relative to dir, where the stack holds the file of
+// the content if any.
+func decodePlans(b []byte, format, dir string, stack []string) ([]*Plan, error) {
+	var values []any
+	var docs []ast.Node
+	switch format {
+	case planFormatJSON:
+		v, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("decode json: %w", err)
+		}
+		values = append(values, v)
+		// NOTE: JSON is parsed as YAML only to locate schema violations
+		var body ast.Node
+		if file, err := parser.ParseBytes(b, 0); err == nil && len(file.Docs) > 0 {
+			body = file.Docs[0].Body
+		}
+		docs = append(docs, body)
+	default:
+		file, err := parser.ParseBytes(b, 0)
+		if err != nil {
+			return nil, fmt.Errorf("parse yaml: %w", err)
+		}
+		for _, doc := range yamlDocuments(file) {
+			v, err := yamlNodeToJSON(doc)
+			if err != nil {
+				return nil, fmt.Errorf("convert yaml: %w", err)
+			}
+			values = append(values, v)
+			docs = append(docs, doc)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no plan found")
+	}
+	plans := make([]*Plan, 0, len(values))
+	for i, v := range values {
+		c := &planComposer{stack: stack}
+		p, err := c.decodePlan(v, docs[i], format, dir)
+		if err != nil {
+			if len(values) > 1 {
+				return nil, fmt.Errorf("document %d: %w", i, err)
+			}
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
+
+// decodePlan validates and decodes the plan value, which is composed with the
+// files that it references. The doc is used to locate schema violations, and
+// may be nil. If the plan violates the schema, it is still returned with the
+// error when it can be decoded, so that its other problems can be reported.
+func (c *planComposer) decodePlan(v any, doc ast.Node, format, dir string) (*Plan, error) {
+	v, err := migratePlanValue(v, doc)
+	if err != nil {
+		// NOTE: Versions that cannot be migrated are violations of the schema
+		se := &SchemaError{Path: "version", Message: err.Error()}
+		if pos := locateNode(doc, []string{"version"}); pos != nil {
+			se.Line, se.Column = pos.Line, pos.Column
+		}
+		return nil, fmt.Errorf("migrate %s: %w", format, se)
+	}
+	if isComposed(v) {
+		if v, err = c.composePlan(v, dir); err != nil {
+			return nil, fmt.Errorf("compose %s: %w", format, err)
+		}
+		// NOTE: Violations of a composed plan cannot be located in any file
+		doc = nil
+	}
+	schemaErr := validateSchema(v, doc)
+	if schemaErr != nil {
+		schemaErr = fmt.Errorf("validate %s: %w", format, schemaErr)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, cmp.Or(schemaErr, fmt.Errorf("encode %s: %w", format, err))
+	}
+	var p Plan
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, cmp.Or(schemaErr, fmt.Errorf("decode %s: %w", format, err))
+	}
+	if err := p.deriveID(); err != nil {
+		return nil, cmp.Or(schemaErr, fmt.Errorf("derive id: %w", err))
+	}
+	return &p, schemaErr
+}
@@ -0,0 +1,324 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStepUnmarshal(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+		key  string
+		err  string
+	}{
+		{
+			name: "registered operator",
+			json: `{"script": {"run": "echo"}, "timeout": "5s"}`,
+			key:  "script",
+		},
+		{
+			name: "unknown operator",
+			json: `{"scrpt": {"run": "echo"}}`,
+			err:  `unknown operator "scrpt" in step`,
+		},
+		{
+			name: "multiple operators",
+			json: `{"script": {"run": "echo"}, "editor": {}}`,
+			err:  "multiple operators defined in a single step: editor, script",
+		},
+		{
+			name: "no operator",
+			json: `{"timeout": "5s"}`,
+			err:  "no operator defined in step",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var s Step
+			err := json.Unmarshal([]byte(tc.json), &s)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("unexpected error: got %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode step: %v", err)
+			}
+			key, err := s.Key()
+			if err != nil {
+				t.Fatalf("failed to get key: %v", err)
+			}
+			if key != tc.key {
+				t.Errorf("unexpected key: got %s, want %s", key, tc.key)
+			}
+		})
+	}
+}
+
+func TestNewPlanFromYAML(t *testing.T) {
+	const header = "version: 0\nid: test\non:\n  repositories: [owner/repo]\ncommit:\n  title: t\n  body: b\n"
+	cases := []struct {
+		name  string
+		steps string
+		err   string
+	}{
+		{
+			name:  "valid",
+			steps: "steps:\n  - script:\n      run: echo\n",
+		},
+		{
+			name:  "unknown operator",
+			steps: "steps:\n  - scrpt:\n      run: echo\n",
+			err:   "9:5: steps.0: additional properties 'scrpt' not allowed",
+		},
+		{
+			name:  "multiple operators",
+			steps: "steps:\n  - script:\n      run: echo\n    ensure:\n      target: [a]\n",
+			err:   "9:5: steps.0: only one of properties 'ensure', 'script' is allowed",
+		},
+		{
+			name:  "no operator",
+			steps: "steps:\n  - timeout: 5s\n",
+			err:   "9:5: steps.0: missing one of properties",
+		},
+		{
+			name:  "wrong type",
+			steps: "steps:\n  - script:\n      run: [echo]\n",
+			err:   "10:7: steps.0.script.run: got array, want string",
+		},
+		{
+			name:  "unknown field",
+			steps: "steps:\n  - script:\n      run: echo\n      shel: bash\n",
+			err:   "11:7: steps.0.script: additional properties 'shel' not allowed",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewPlanFromYAML(strings.NewReader(header + tc.steps))
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("failed to decode plan: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("unexpected error: got %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestNewPlanFromYAMLRepositories(t *testing.T) {
+	_, err := NewPlanFromYAML(strings.NewReader("version: 0\nid: test\non:\n  repositories:\n    - owner/repo\n    - invalid\nsteps: []\ncommit: {title: t, body: b}\n"))
+	want := "6:7: on.repositories.1: 'invalid' does not match pattern"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("unexpected error: got %v, want %q", err, want)
+	}
+}
+
+func TestPlanFormat(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "plan.json", content: "version: 0", want: planFormatJSON},
+		{name: "plan.YAML", content: "{}", want: planFormatYAML},
+		{name: "plan.yml", content: "{}", want: planFormatYAML},
+		{name: "-", content: "\n  {\"version\": 0}", want: planFormatJSON},
+		{name: "-", content: "---\nversion: 0", want: planFormatYAML},
+	}
+	for _, tc := range cases {
+		if got := planFormat(tc.name, []byte(tc.content)); got != tc.want {
+			t.Errorf("unexpected format of %s %q: got %s, want %s", tc.name, tc.content, got, tc.want)
+		}
+	}
+}
+
+func TestNewPlansFromYAML(t *testing.T) {
+	const doc = "version: 0\nid: %s\non:\n  repositories: [owner/repo]\nsteps: []\ncommit: {title: t, body: b}\n"
+	plans, err := NewPlansFromYAML(strings.NewReader("---\n" + fmt.Sprintf(doc, "a") + "---\n" + fmt.Sprintf(doc, "b") + "---\n"))
+	if err != nil {
+		t.Fatalf("failed to decode plans: %v", err)
+	}
+	if len(plans) != 2 || plans[0].ID != "a" || plans[1].ID != "b" {
+		t.Fatalf("unexpected plans: %+v", plans)
+	}
+
+	_, err = NewPlansFromYAML(strings.NewReader(fmt.Sprintf(doc, "a") + "---\n" + strings.Replace(fmt.Sprintf(doc, "b"), "steps: []", "steps: {}", 1)))
+	want := "document 1: validate yaml: 12:1: steps: got object, want array"
+	if err == nil || err.Error() != want {
+		t.Fatalf("unexpected error: got %v, want %q", err, want)
+	}
+}
+
+func TestPlanDeriveID(t *testing.T) {
+	const doc = "version: 0\non:\n  repositories: [%s]\nsteps:\n  - script: {run: echo, shell: bash}\ncommit: {title: %s, body: b}\n"
+	decode := func(repo, title string) *Plan {
+		t.Helper()
+		p, err := NewPlanFromYAML(strings.NewReader(fmt.Sprintf(doc, repo, title)))
+		if err != nil {
+			t.Fatalf("failed to decode plan: %v", err)
+		}
+		return p
+	}
+	p := decode("owner/a", "t")
+	if len(p.ID) != 32 || !p.derivedID {
+		t.Fatalf("unexpected id: %s", p.ID)
+	}
+	if err := validatePlanID(p.ID); err != nil {
+		t.Errorf("derived id is not valid: %v", err)
+	}
+	if q := decode("owner/b", "t"); q.ID != p.ID {
+		t.Errorf("id depends on repositories: got %s, want %s", q.ID, p.ID)
+	}
+	if q := decode("owner/a", "u"); q.ID == p.ID {
+		t.Errorf("id does not depend on commit: got %s", q.ID)
+	}
+}
+
+func TestPlanSparsePatterns(t *testing.T) {
+	const doc = `version: 0
+id: test
+on:
+  repositories: [owner/repo]
+  where:
+    - exists: go.mod
+%s
+steps:
+  - editor:
+      target: ["**/*.md", "!vendor/**"]
+      replacements: [{search: a, replace: b}]
+  - workingDirectory: web
+    if:
+      contains: {path: package.json, pattern: react}
+    file:
+      action: move
+      target: ["src/{a,b}/*.js"]
+      destination: lib/
+  - file:
+      action: copy
+      source: plan
+      target: [LICENSE]
+      destination: LICENSE
+  - script: {run: echo, shell: bash}
+commit: {title: t, body: b}
+`
+	cases := []struct {
+		name     string
+		checkout string
+		want     []string
+	}{
+		{
+			name: "full checkout",
+		},
+		{
+			name:     "sparse",
+			checkout: "checkout: {sparse: [/docs/, /.gitignore]}",
+			want:     []string{".gitignore", ".gitattributes", "/docs/", "/.gitignore"},
+		},
+		{
+			name:     "sparse targets",
+			checkout: "checkout: {sparseTargets: true, sparse: [/Makefile]}",
+			want:     []string{".gitignore", ".gitattributes", "/go.mod", "/**/*.md", "/web/package.json", "/web/src/", "/web/lib", "/LICENSE", "/Makefile"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewPlanFromYAML(strings.NewReader(fmt.Sprintf(doc, tc.checkout)))
+			if err != nil {
+				t.Fatalf("failed to decode plan: %v", err)
+			}
+			if got := p.sparsePatterns(); !slices.Equal(got, tc.want) {
+				t.Errorf("unexpected patterns: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidatePlanID(t *testing.T) {
+	cases := map[string]bool{
+		"update-timestamp":       true,
+		"fb3e83f89b0b310ec3defc": true,
+		"v1.2":                   true,
+		"":                       false,
+		"@":                      false,
+		".hidden":                false,
+		"ends.":                  false,
+		"branch.lock":            false,
+		"a..b":                   false,
+		"a@{b":                   false,
+		"has space":              false,
+		"a/b":                    false,
+		"a:b":                    false,
+		"a\x7fb":                 false,
+	}
+	for id, valid := range cases {
+		if err := validatePlanID(id); (err == nil) != valid {
+			t.Errorf("unexpected result for %q: got %v, want valid %v", id, err, valid)
+		}
+	}
+}
+
+func TestCommitForRepository(t *testing.T) {
+	c := Commit{
+		Title:    "t",
+		Body:     "b",
+		Trailers: []CommitTrailer{{Key: "Campaign", Value: "{{ .Plan.ID }}/{{ .Repository.Repo }}"}},
+	}
+	tc := TemplateContext{Plan: Plan{ID: "test"}, Repository: NewRepositoryContext("owner/repo")}
+	got, err := c.forRepository(tc)
+	if err != nil {
+		t.Fatalf("failed to render commit: %v", err)
+	}
+	if got.Branch != "bulk/test" || got.Trailers[0].Value != "test/repo" {
+		t.Errorf("unexpected commit: %+v", got)
+	}
+	if c.Trailers[0].Value != "{{ .Plan.ID }}/{{ .Repository.Repo }}" {
+		t.Errorf("trailers of the plan are modified: %+v", c.Trailers)
+	}
+
+	c.Branch = "campaigns/{{ .Repository.Owner }}/{{ .Plan.ID }}"
+	if got, err = c.forRepository(tc); err != nil || got.Branch != "campaigns/owner/test" {
+		t.Errorf("unexpected branch: got %s, %v", got.Branch, err)
+	}
+	c.Branch = "campaigns/{{ .Repository.Name }}.lock"
+	if _, err = c.forRepository(tc); err == nil || !strings.Contains(err.Error(), "must not end with .lock") {
+		t.Errorf("unexpected error: got %v", err)
+	}
+}
+
+func TestParseCommitIdentity(t *testing.T) {
+	id, err := ParseCommitIdentity("Bulk Bot <bot@example.com>")
+	if err != nil {
+		t.Fatalf("failed to parse identity: %v", err)
+	}
+	if id.Name != "Bulk Bot" || id.Email != "bot@example.com" {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+	for _, s := range []string{"Bulk Bot", "<bot@example.com>", "Bulk Bot <bot@example.com> trailing"} {
+		if _, err := ParseCommitIdentity(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParseCommitTrailer(t *testing.T) {
+	tr, err := ParseCommitTrailer("Co-authored-by: Bulk Bot <bot@example.com>")
+	if err != nil {
+		t.Fatalf("failed to parse trailer: %v", err)
+	}
+	if tr.Key != "Co-authored-by" || tr.Value != "Bulk Bot <bot@example.com>" {
+		t.Errorf("unexpected trailer: %+v", tr)
+	}
+	for _, s := range []string{"no separator", "Has Space: v", "idempotency-key: x"} {
+		if _, err := ParseCommitTrailer(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// operatorSpec describes an operator that can be used as a step.
+type operatorSpec struct {
+	key       string       // Key of the operator in a step, e.g. script
+	typ       reflect.Type // Struct type of the operator config
+	templates []string     // JSON names of the fields rendered as templates
+}
+
+// new returns a new zero config of the operator.
+func (s operatorSpec) new() Operator {
+	return reflect.New(s.typ).Interface().(Operator)
+}
+
+// operators is the registry of operators keyed by their step key.
+var operators = map[string]operatorSpec{}
+
+// registerOperator registers the operator with its step key and the JSON names
+// of its string fields that are rendered as templates. It panics if the key is
+// already registered or a template field does not exist, so that mistakes are
+// caught at init time.
+func registerOperator(key string, op Operator, templates ...string) {
+	if _, ok := operators[key]; ok {
+		panic(fmt.Sprintf("operator %s is already registered", key))
+	}
+	typ := reflect.TypeOf(op)
+	if typ.Kind() != reflect.Pointer || typ.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("operator %s must be a pointer to a struct", key))
+	}
+	for _, name := range templates {
+		f, ok := jsonField(typ.Elem(), name)
+		if !ok || f.Type.Kind() != reflect.String {
+			panic(fmt.Sprintf("operator %s has no string field %s", key, name))
+		}
+	}
+	operators[key] = operatorSpec{
+		key:       key,
+		typ:       typ.Elem(),
+		templates: templates,
+	}
+}
+
+// operatorKeys returns the sorted keys of the registered operators.
+func operatorKeys() []string {
+	return slices.Sorted(maps.Keys(operators))
+}
+
+// operatorKeyOf returns the step key of the operator.
+func operatorKeyOf(op Operator) (string, bool) {
+	typ := reflect.TypeOf(op)
+	for key, spec := range operators {
+		if typ == reflect.PointerTo(spec.typ) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// field returns the settable value of the field of the operator config with
+// the JSON name.
+func (s operatorSpec) field(op Operator, name string) reflect.Value {
+	f, _ := jsonField(s.typ, name)
+	return reflect.ValueOf(op).Elem().FieldByIndex(f.Index)
+}
+
+// clone returns a shallow copy of the operator config, whose fields can be
+// set without affecting the operator.
+func (s operatorSpec) clone(op Operator) Operator {
+	v := reflect.New(s.typ)
+	v.Elem().Set(reflect.ValueOf(op).Elem())
+	return v.Interface().(Operator)
+}
+
+// jsonField returns the struct field with the JSON name.
+func jsonField(typ reflect.Type, name string) (reflect.StructField, bool) {
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == name || (tag == "" && f.Name == name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
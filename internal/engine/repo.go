@@ -7,18 +7,37 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
+// partialCloneFilter is the object filter of partial clones, which omits
+// every blob until it is checked out.
+const partialCloneFilter = "blob:none"
+
 type Repository struct {
-	id     string // ID of the execution
-	dir    string // Local worktree of the repository
-	remote string // URL of the Git remote
-	auto   bool   // Whether to skip confirmation prompts
+	id      string   // ID of the execution
+	head    string   // Branch that the changes are pushed to
+	dir     string   // Local worktree of the repository
+	remote  string   // URL of the Git remote
+	planDir string   // Directory containing the plan file
+	auto    bool     // Whether to skip confirmation prompts
+	cache   *Cache   // Cache of mirrors to fetch from, if any
+	sparse  []string // Patterns of the sparse checkout, if any
+
+	// NOTE: The mirror must be kept while the worktree borrows its objects
+	releaseMirror func() error
 }
 
-func (r *Repository) ApplyAndPushChanges(title, body string, steps ...Step) error {
+// ErrNotApplicable is returned when none of the steps apply to a repository.
+var ErrNotApplicable = errors.New("not applicable")
+
+// ErrFilteredOut is returned when a repository does not satisfy the
+// applicability predicates of the plan.
+var ErrFilteredOut = errors.New("filtered out")
+
+func (r *Repository) ApplyAndPushChanges(tc TemplateContext, commit Commit, steps ...Step) error {
 	exists, err := r.isRemoteBranchExists()
 	if err != nil {
 		return fmt.Errorf("check remote branch exists: %w", err)
@@ -28,30 +47,56 @@ func (r *Repository) ApplyAndPushChanges(title, body string, steps ...Step) erro
 	}
 
 	// Set up working branch
-	if _, err := r.Run("git", "fetch", "--depth", "1", "origin", "HEAD"); err != nil {
+	if len(r.sparse) > 0 {
+		if _, err := r.Run("git", append([]string{"sparse-checkout", "set", "--no-cone", "--"}, r.sparse...)...); err != nil {
+			return fmt.Errorf("set sparse checkout: %w", err)
+		}
+	}
+	if err := r.fetchHead(); err != nil {
 		return fmt.Errorf("clone repo: %w", err)
 	}
 	if _, err := r.Run("git", "switch", "--create", r.branch(), "FETCH_HEAD"); err != nil {
 		return fmt.Errorf("checkout branch: %w", err)
 	}
 
+	// Filter out inapplicable repositories before any step runs
+	for i, c := range tc.Plan.On.Where {
+		ok, reason, err := c.Evaluate(OperatorContext{Dir: r.dir, PlanDir: r.planDir, Template: tc})
+		if err != nil {
+			return fmt.Errorf("evaluate on.where.%d: %w", i, err)
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrFilteredOut, reason)
+		}
+	}
+
 	// Apply changes
+	applied := 0
 	for i, step := range steps {
-		op, err := step.GetOperator()
+		skipped, err := r.applyStep(tc, step)
 		if err != nil {
-			return fmt.Errorf("get operator for step %d: %w", i, err)
+			return fmt.Errorf("apply step %d: %w", i, err)
 		}
-		// NOTE: Target needs to be relative of working dir
-		if err := op.Apply(OperatorContext{Dir: r.dir}); err != nil {
-			return fmt.Errorf("apply operator for step %d: %w", i, err)
+		if skipped != "" {
+			fmt.Printf("Skipping step %d: %s\n", i, skipped)
+			continue
 		}
+		applied++
+	}
+	if len(steps) > 0 && applied == 0 {
+		return fmt.Errorf("%w: all steps were skipped", ErrNotApplicable)
 	}
 
 	// Stage changes and commit
-	if _, err := r.Run("git", "add", "."); err != nil {
+	// NOTE: Files created outside of a sparse checkout are otherwise ignored
+	add := []string{"add", "."}
+	if len(r.sparse) > 0 {
+		add = []string{"add", "--sparse", "."}
+	}
+	if _, err := r.Run("git", add...); err != nil {
 		return fmt.Errorf("add files: %w", err)
 	}
-	if _, err := r.Run("git", "commit", "--message", title, "--message", body, "--trailer", fmt.Sprintf("Idempotency-Key:%s", r.id)); err != nil {
+	if _, err := r.Run("git", commitArgs(r.id, commit)...); err != nil {
 		return fmt.Errorf("commit files: %w", err)
 	}
 
@@ -80,6 +125,70 @@ func (r *Repository) ApplyAndPushChanges(title, body string, steps ...Step) erro
 	return nil
 }
 
+// applyStep applies the step onto the worktree. If the step is skipped by its
+// condition, the reason is returned instead.
+func (r *Repository) applyStep(tc TemplateContext, step Step) (skipped string, err error) {
+	key, err := step.Key()
+	if err != nil {
+		return "", fmt.Errorf("get operator: %w", err)
+	}
+	timeout, err := step.GetTimeout()
+	if err != nil {
+		return "", fmt.Errorf("get timeout: %w", err)
+	}
+
+	// NOTE: The working directory may be absent or a symlink in the repo
+	wd, err := resolvePath(r.dir, step.WorkingDirectory)
+	if err != nil {
+		return "", fmt.Errorf("resolve working dir: %w", err)
+	}
+	if fi, err := os.Stat(wd); err != nil || !fi.IsDir() {
+		// NOTE: Conditional steps usually target directories that only some
+		// repos have, so they are skipped instead
+		if step.If != nil && errors.Is(err, os.ErrNotExist) {
+			return fmt.Sprintf("working dir %s does not exist", step.WorkingDirectory), nil
+		}
+		return "", fmt.Errorf("working dir %s is not a directory in the repo", step.WorkingDirectory)
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// NOTE: Target needs to be relative of working dir
+	opctx := OperatorContext{
+		Context: ctx,
+		Dir:     r.dir,
+		WorkDir: step.WorkingDirectory,
+		PlanDir: r.planDir,
+		Env:     step.GetEnv(),
+
+		Template: tc,
+	}
+	if step.If != nil {
+		ok, reason, err := step.If.Evaluate(opctx)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", fmt.Errorf("evaluate condition: timed out after %s: %w", timeout, err)
+			}
+			return "", fmt.Errorf("evaluate condition: %w", err)
+		}
+		if !ok {
+			return reason, nil
+		}
+	}
+	if err := step.Operator.Apply(opctx); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("apply %s: timed out after %s: %w", key, timeout, err)
+		}
+		return "", fmt.Errorf("apply %s: %w", key, err)
+	}
+	return "", nil
+}
+
 func (r *Repository) CreateGitHubPullRequest(title, body string) error {
 	exists, err := r.isGitHubPullRequestExists()
 	if err != nil {
@@ -98,8 +207,71 @@ func (r *Repository) CreateGitHubPullRequest(title, body string) error {
 	return nil
 }
 
+// fetchHead fetches the default branch of the remote into FETCH_HEAD, through
+// the mirror of the remote if there is a cache. Only the blobs of sparse
+// checkouts are fetched from the remote, and the remaining blobs are fetched
+// on demand.
+func (r *Repository) fetchHead() error {
+	if r.cache == nil {
+		args := []string{"fetch", "--depth", "1"}
+		if len(r.sparse) > 0 {
+			// NOTE: Servers without filter support ignore it with a warning,
+			// and send every blob instead
+			if err := r.Configure([][2]string{
+				{"remote.origin.promisor", "true"},
+				{"remote.origin.partialCloneFilter", partialCloneFilter},
+			}); err != nil {
+				return fmt.Errorf("configure partial clone: %w", err)
+			}
+			args = append(args, "--filter="+partialCloneFilter)
+		}
+		if _, err := r.Run("git", append(args, "origin", "HEAD")...); err != nil {
+			return fmt.Errorf("fetch remote: %w", err)
+		}
+		return nil
+	}
+	mirror, release, err := r.cache.Mirror(r.remote)
+	if err != nil {
+		return fmt.Errorf("update mirror: %w", err)
+	}
+	r.releaseMirror = release
+	// NOTE: Objects of the mirror are borrowed instead of copied
+	alternates := filepath.Join(r.dir, ".git", "objects", "info", "alternates")
+	if err := os.WriteFile(alternates, []byte(filepath.Join(mirror, "objects")+"\n"), 0644); err != nil {
+		return fmt.Errorf("write alternates: %w", err)
+	}
+	if _, err := r.Run("git", "fetch", "--no-tags", mirror, cacheHeadRef); err != nil {
+		return fmt.Errorf("fetch mirror: %w", err)
+	}
+	return nil
+}
+
 func (r *Repository) branch() string {
-	return fmt.Sprintf("bulk/%s", r.id)
+	return r.head
+}
+
+// commitArgs returns the arguments to git that commit the staged changes with
+// the details of the commit.
+func commitArgs(id string, commit Commit) []string {
+	var args []string
+	// NOTE: The committer cannot be set with a flag of git commit, and falls
+	// back to the author as CI machines rarely have an identity configured
+	committer := commit.Committer
+	if committer == nil {
+		committer = commit.Author
+	}
+	if committer != nil {
+		args = append(args, "-c", "user.name="+committer.Name, "-c", "user.email="+committer.Email)
+	}
+	args = append(args, "commit", "--message", commit.Title, "--message", commit.Body)
+	if commit.Author != nil {
+		args = append(args, "--author", commit.Author.String())
+	}
+	args = append(args, "--trailer", fmt.Sprintf("%s:%s", idempotencyKeyTrailer, id))
+	for _, t := range commit.Trailers {
+		args = append(args, "--trailer", fmt.Sprintf("%s:%s", t.Key, t.Value))
+	}
+	return args
 }
 
 func (r *Repository) isRemoteBranchExists() (bool, error) {
@@ -154,25 +326,44 @@ func (r *Repository) Run(cmd string, args ...string) (string, error) {
 	return r.RunContext(context.Background(), cmd, args...)
 }
 
+// Configure sets the Git configuration of the worktree, as pairs of keys and
+// values.
+func (r *Repository) Configure(config [][2]string) error {
+	for _, kv := range config {
+		if _, err := r.Run("git", "config", "--local", kv[0], kv[1]); err != nil {
+			return fmt.Errorf("set %s: %w", kv[0], err)
+		}
+	}
+	return nil
+}
+
 func (r *Repository) Close() error {
 	if err := os.RemoveAll(r.dir); err != nil {
 		return fmt.Errorf("remove working dir: %w", err)
 	}
+	if r.releaseMirror != nil {
+		if err := r.releaseMirror(); err != nil {
+			return fmt.Errorf("release mirror: %w", err)
+		}
+	}
 	return nil
 }
 
-func NewRepository(id, remote string, auto bool) (*Repository, error) {
-	// TODO: Explore using cache dir with temp dir?
+func NewRepository(id, branch, remote, planDir string, auto bool, cache *Cache, sparse []string) (*Repository, error) {
 	d, err := os.MkdirTemp("", id) // TODO: Slugify remote for nicer name?
 	if err != nil {
 		return nil, fmt.Errorf("create temp dir: %w", err)
 	}
 
 	r := Repository{
-		id:     id, // TODO: Derive the ID from input file hash?
-		dir:    d,
-		remote: remote,
-		auto:   auto,
+		id:      id,
+		head:    branch,
+		dir:     d,
+		remote:  remote,
+		planDir: planDir,
+		auto:    auto,
+		cache:   cache,
+		sparse:  sparse,
 	}
 
 	if _, err := r.Run("git", "init", "."); err != nil {
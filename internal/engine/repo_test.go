@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommitArgs(t *testing.T) {
+	author := &CommitIdentity{Name: "Bulk Bot", Email: "bot@example.com"}
+	got := commitArgs("test", Commit{
+		Title:    "t",
+		Body:     "b",
+		Author:   author,
+		Trailers: []CommitTrailer{{Key: "Campaign", Value: "c"}},
+	})
+	want := []string{
+		"-c", "user.name=Bulk Bot", "-c", "user.email=bot@example.com",
+		"commit", "--message", "t", "--message", "b",
+		"--author", "Bulk Bot <bot@example.com>",
+		"--trailer", "Idempotency-Key:test",
+		"--trailer", "Campaign:c",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected args:\ngot  %q\nwant %q", got, want)
+	}
+
+	got = commitArgs("test", Commit{Title: "t", Body: "b"})
+	want = []string{"commit", "--message", "t", "--message", "b", "--trailer", "Idempotency-Key:test"}
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected args:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestApplyStepWorkingDirectory(t *testing.T) {
+	r := &Repository{dir: t.TempDir()}
+	step := Step{
+		WorkingDirectory: "missing",
+		Operator:         &OperatorExecScript{Run: "exit 1", Shell: "bash"},
+	}
+	if _, err := r.applyStep(TemplateContext{}, step); err == nil {
+		t.Errorf("expected error for missing working dir of unconditional step")
+	}
+
+	step.If = &Condition{Exists: "go.mod"}
+	skipped, err := r.applyStep(TemplateContext{}, step)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if skipped == "" {
+		t.Errorf("expected conditional step to be skipped")
+	}
+}
+
+func TestApplyStep(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	cases := []struct {
+		name  string
+		step  Step
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "env",
+			step:  Step{Env: map[string]string{"BULK_TEST": "a b"}, Operator: &OperatorExecScript{Run: `printf '%s' "$BULK_TEST" > env.txt`, Shell: "sh"}},
+			files: map[string]string{"env.txt": "a b"},
+		},
+		{
+			name:  "working directory",
+			step:  Step{WorkingDirectory: "sub", Operator: &OperatorExecScript{Run: "printf x > out.txt", Shell: "sh"}},
+			files: map[string]string{"sub/.keep": "", "sub/out.txt": "x"},
+		},
+		{
+			name:  "working directory target",
+			step:  Step{WorkingDirectory: "sub", Operator: &OperatorFile{Action: "copy", Target: []string{".keep"}, Destination: "copy"}},
+			files: map[string]string{"sub/.keep": "", "sub/copy": ""},
+		},
+		{
+			// NOTE: The shell is replaced by sleep so that the killed step
+			// leaves no child holding the output of the test
+			name: "timeout",
+			step: Step{Timeout: "100ms", Operator: &OperatorExecScript{Run: "exec sleep 5", Shell: "sh"}},
+			err:  "apply script: timed out after 100ms",
+		},
+		{
+			name: "condition timeout",
+			step: Step{Timeout: "100ms", If: &Condition{Run: "exec sleep 5", Shell: "sh"}, Operator: &OperatorExecScript{Run: "true", Shell: "sh"}},
+			err:  "evaluate condition: timed out after 100ms",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Repository{dir: t.TempDir()}
+			writeTestFiles(t, r.dir, map[string]string{"sub/.keep": ""})
+			start := time.Now()
+			_, err := r.applyStep(TemplateContext{}, tc.step)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("unexpected error: got %v, want %q", err, tc.err)
+				}
+				if d := time.Since(start); d > 3*time.Second {
+					t.Errorf("step is not killed by its timeout: took %s", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+			want := maps.Clone(tc.files)
+			want["sub/.keep"] = ""
+			if got := readTestFiles(t, r.dir); !maps.Equal(got, want) {
+				t.Errorf("unexpected files: got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// scaffoldSchemaURL is the URL of the schema referenced by scaffolded plans,
+// which is served raw for language servers.
+const scaffoldSchemaURL = "https://raw.githubusercontent.com/loozhengyuan/bulk/main/schema/bulk-v0.json"
+
+// scaffoldTemplates are the names of the templates of scaffolded plans, which
+// differ in their steps.
+var scaffoldTemplates = []string{"script", "editor", "gomod", "file"}
+
+// NOTE: Delimiters differ from the default so that the plan templates, which
+// are rendered per repository, can be written literally
+var scaffoldTemplate = template.Must(template.New("plan").Delims("[[", "]]").Funcs(template.FuncMap{
+	"quote": yamlQuote,
+}).Parse(`# yaml-language-server: $schema=[[ .SchemaURL ]]
+version: [[ .Version ]]
+id: [[ .ID ]]
+
+# Base plan that this plan is merged onto, relative to this file.
+# extends: ../shared/base.yml
+
+on:
+[[- if .Repositories ]]
+  # List of repositories in the owner/repo form.
+  repositories:
+[[- range .Repositories ]]
+    - [[ quote . ]]
+[[- end ]]
+[[- else if not .Search ]]
+  # List of repositories in the owner/repo form.
+  repositories:
+    - owner/repo
+[[- end ]]
+[[- if .Search ]]
+  # Search for repositories containing matching code.
+  repositoriesMatch:
+    search: [[ quote .Search ]]
+    # owners: [owner]
+    # filename: go.mod
+[[- else ]]
+  # Search for repositories containing matching code.
+  # repositoriesMatch:
+  #   search: github.com/pkg/errors
+  #   owners: [owner]
+  #   filename: go.mod
+[[- end ]]
+  # Predicates evaluated after cloning. Repositories not satisfying all of
+  # them are filtered out.
+  # where:
+  #   - exists: package.json
+  #   - contains:
+  #       path: go.mod
+  #       pattern: ^go 1\.2[0-4]$
+  #   - expr: '{{ eq .Repository.Owner "owner" }}'
+
+# Only check out the files targeted by the steps, for large repositories.
+# checkout:
+#   sparseTargets: true
+#   sparse:
+#     - /docs/
+
+steps:
+[[- .Steps ]]
+    # Condition for the step to be applied, and its environment.
+    # if:
+    #   exists: README.md
+    # env:
+    #   LANG: C.UTF-8
+    # workingDirectory: docs
+    # timeout: 5m
+  # Steps shared by several plans can be included from a file.
+  # - include: ../shared/setup.yml
+
+commit:
+  title: [[ quote .Title ]]
+  body: |
+    This commit was created by bulk for {{ .Repository.Name }}.
+[[- define "script" ]]
+  - script:
+      # Script rendered as a template for each repository.
+      run: |
+        echo "Maintained by {{ .Repository.Owner }}" > MAINTAINERS.md
+      # shell: bash
+[[- end ]]
+[[- define "editor" ]]
+  - editor:
+      # Files to edit. Accepts Glob expressions including **.
+      target:
+        - "**/*.md"
+      replacements:
+        - search: http://(\S+)
+          replace: https://$1
+          # literal: true
+          # expect:
+          #   min: 1
+[[- end ]]
+[[- define "gomod" ]]
+  - script:
+      # Updates a Go module dependency.
+      run: |
+        go get github.com/owner/module@latest
+        go mod tidy
+[[- end ]]
+[[- define "file" ]]
+  - file:
+      # One of delete, move, copy or chmod.
+      action: move
+      target:
+        - docs/OLD.md
+      destination: docs/NEW.md
+[[- end ]]
+`))
+
+// ScaffoldOptions are the options of a scaffolded plan.
+type ScaffoldOptions struct {
+	// Template of the steps of the plan, e.g. script.
+	Template string
+	// Repositories targeted by the plan, in owner/repo form.
+	Repositories []string
+	// Code search query for repositories targeted by the plan.
+	Search string
+	// Title of the commit.
+	Title string
+}
+
+// ScaffoldTemplates returns the names of the templates of scaffolded plans.
+func ScaffoldTemplates() []string {
+	return slices.Clone(scaffoldTemplates)
+}
+
+// ScaffoldPlan returns a new plan with a random id, which documents the
+// sections of plans with commented examples.
+func ScaffoldPlan(opts ScaffoldOptions) ([]byte, error) {
+	if !slices.Contains(scaffoldTemplates, opts.Template) {
+		return nil, fmt.Errorf("unknown template %s, expected one of: %s", opts.Template, strings.Join(scaffoldTemplates, ", "))
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("generate id: %w", err)
+	}
+	if opts.Title == "" {
+		opts.Title = "chore: apply bulk changes"
+	}
+	var steps strings.Builder
+	if err := scaffoldTemplate.ExecuteTemplate(&steps, opts.Template, nil); err != nil {
+		return nil, fmt.Errorf("render steps: %w", err)
+	}
+	data := struct {
+		ScaffoldOptions
+		SchemaURL string
+		Version   int
+		ID        string
+		Steps     string
+	}{
+		ScaffoldOptions: opts,
+		SchemaURL:       scaffoldSchemaURL,
+		Version:         LatestPlanVersion(),
+		ID:              id,
+		Steps:           steps.String(),
+	}
+	var buf bytes.Buffer
+	if err := scaffoldTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+
+	// NOTE: Invalid options are caught by decoding the plan
+	if _, err := NewPlanFromYAML(bytes.NewReader(buf.Bytes())); err != nil {
+		return nil, fmt.Errorf("decode plan: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlQuote returns the string as a double-quoted YAML scalar.
+func yamlQuote(s string) (string, error) {
+	// NOTE: JSON strings are valid double-quoted YAML scalars
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
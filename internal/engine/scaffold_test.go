@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestScaffoldPlan(t *testing.T) {
+	for _, name := range ScaffoldTemplates() {
+		t.Run(name, func(t *testing.T) {
+			b, err := ScaffoldPlan(ScaffoldOptions{Template: name})
+			if err != nil {
+				t.Fatalf("failed to scaffold plan: %v", err)
+			}
+			if !strings.HasPrefix(string(b), "# yaml-language-server: $schema="+scaffoldSchemaURL+"\n") {
+				t.Errorf("plan does not reference the schema:\n%s", b)
+			}
+			p, err := NewPlanFromYAML(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("failed to decode plan: %v", err)
+			}
+			if len(p.ID) != 32 || len(p.Steps) != 1 {
+				t.Errorf("unexpected plan: %+v", p)
+			}
+		})
+	}
+}
+
+func TestScaffoldPlanOptions(t *testing.T) {
+	b, err := ScaffoldPlan(ScaffoldOptions{
+		Template: "script",
+		Search:   `"github.com/pkg/errors" language:go`,
+		Title:    "chore: drop pkg/errors",
+	})
+	if err != nil {
+		t.Fatalf("failed to scaffold plan: %v", err)
+	}
+	p, err := NewPlanFromYAML(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to decode plan: %v", err)
+	}
+	if p.On.RepositoriesMatch.Search != `"github.com/pkg/errors" language:go` || len(p.On.Repositories) != 0 || p.Commit.Title != "chore: drop pkg/errors" {
+		t.Errorf("unexpected plan: %+v", p)
+	}
+
+	_, err = ScaffoldPlan(ScaffoldOptions{Template: "script", Repositories: []string{"invalid"}})
+	if err == nil || !strings.Contains(err.Error(), "does not match pattern") {
+		t.Fatalf("unexpected error: got %v, want pattern mismatch", err)
+	}
+}
+
+func TestScaffoldPlanRepositoryTemplates(t *testing.T) {
+	b, err := ScaffoldPlan(ScaffoldOptions{Template: "script", Repositories: []string{"acme/web"}})
+	if err != nil {
+		t.Fatalf("failed to scaffold plan: %v", err)
+	}
+	p, err := NewPlanFromYAML(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to decode plan: %v", err)
+	}
+	if _, err := New(p); err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	tc := TemplateContext{Plan: *p, Repository: NewRepositoryContext("acme/web")}
+	commit, err := p.Commit.forRepository(tc)
+	if err != nil {
+		t.Fatalf("failed to render commit: %v", err)
+	}
+	if !strings.Contains(commit.Body, "created by bulk for acme/web.") {
+		t.Errorf("unexpected body: %q", commit.Body)
+	}
+	steps, err := stepsForRepository(p.Steps, tc)
+	if err != nil {
+		t.Fatalf("failed to render steps: %v", err)
+	}
+	if run := steps[0].Operator.(*OperatorExecScript).Run; !strings.Contains(run, `"Maintained by acme"`) {
+		t.Errorf("unexpected script: %q", run)
+	}
+	if run := p.Steps[0].Operator.(*OperatorExecScript).Run; !strings.Contains(run, "{{ .Repository.Owner }}") {
+		t.Errorf("steps of the plan are rendered: %q", run)
+	}
+}
@@ -0,0 +1,538 @@
+package engine
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/token"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+const (
+	schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	schemaID    = "https://github.com/loozhengyuan/bulk/blob/main/schema/bulk-v0.json"
+)
+
+// jsonSchema is the subset of JSON Schema used to describe plans.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Maximum              *int                   `json:"maximum,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           schemaProperties       `json:"properties,omitempty"`
+	PropertyNames        *jsonSchema            `json:"propertyNames,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	MinProperties        *int                   `json:"minProperties,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+	If                   *jsonSchema            `json:"if,omitempty"`
+	Else                 *jsonSchema            `json:"else,omitempty"`
+	Defs                 map[string]*jsonSchema `json:"$defs,omitempty"`
+}
+
+type schemaProperty struct {
+	Name   string
+	Schema *jsonSchema
+}
+
+// schemaProperties are the properties of an object schema, which are encoded
+// in the order that they are declared.
+type schemaProperties []schemaProperty
+
+func (p schemaProperties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(prop.Name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(prop.Schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// get returns the schema of the named property, or nil if there is none.
+func (p schemaProperties) get(name string) *jsonSchema {
+	for _, prop := range p {
+		if prop.Name == name {
+			return prop.Schema
+		}
+	}
+	return nil
+}
+
+// schemaExtender is implemented by types whose schema cannot be fully
+// described by their fields and struct tags.
+type schemaExtender interface {
+	extendSchema(g *schemaGenerator, s *jsonSchema)
+}
+
+// schemaDefs are the types that are generated once under $defs and
+// referenced wherever they are used.
+var schemaDefs = map[reflect.Type]string{
+	reflect.TypeFor[Condition](): "condition",
+}
+
+// schemaGenerator generates the JSON schema of plans from their Go types.
+type schemaGenerator struct {
+	// docs are the descriptions of types and fields, keyed by the type name
+	// or the type name and field name separated by a dot.
+	docs map[string]string
+	defs map[string]*jsonSchema
+}
+
+// generateSchema returns the JSON schema of plans, using the docs to describe
+// the types and fields. Docs may be nil where descriptions are not needed.
+func generateSchema(docs map[string]string) *jsonSchema {
+	g := &schemaGenerator{
+		docs: docs,
+		defs: map[string]*jsonSchema{},
+	}
+	s := g.object(reflect.TypeFor[Plan]())
+	s.Schema = schemaDraft
+	s.ID = schemaID
+	s.Defs = g.defs
+	return s
+}
+
+// schemaOf returns the schema of the type.
+func (g *schemaGenerator) schemaOf(t reflect.Type) *jsonSchema {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if name, ok := schemaDefs[t]; ok {
+		if _, ok := g.defs[name]; !ok {
+			// NOTE: Placeholder prevents infinite recursion on cyclic types
+			g.defs[name] = nil
+			def := g.object(t)
+			def.Description = g.typeDoc(t)
+			g.defs[name] = def
+		}
+		return &jsonSchema{Ref: "#/$defs/" + name}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return g.object(t)
+	default:
+		// NOTE: Interfaces accept any value
+		return &jsonSchema{}
+	}
+}
+
+// object returns the schema of the struct type, where fields without
+// omitempty or omitzero are required.
+func (g *schemaGenerator) object(t reflect.Type) *jsonSchema {
+	s := &jsonSchema{
+		Type:                 "object",
+		AdditionalProperties: false,
+	}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := g.schemaOf(f.Type)
+		if err := applySchemaTag(fs, f.Tag.Get("jsonschema")); err != nil {
+			panic(fmt.Sprintf("invalid jsonschema tag of %s.%s: %v", t.Name(), f.Name, err))
+		}
+		fs.Description = g.docs[t.Name()+"."+f.Name]
+		s.Properties = append(s.Properties, schemaProperty{Name: name, Schema: fs})
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	if e, ok := reflect.New(t).Interface().(schemaExtender); ok {
+		e.extendSchema(g, s)
+	}
+	return s
+}
+
+// typeDoc returns the description of the type from its doc comment, with the
+// leading type name removed, e.g. "Foo is a bar." becomes "A bar.".
+func (g *schemaGenerator) typeDoc(t reflect.Type) string {
+	doc, ok := strings.CutPrefix(g.docs[t.Name()], t.Name()+" ")
+	if !ok {
+		return doc
+	}
+	doc = strings.TrimPrefix(doc, "is ")
+	if doc == "" {
+		return doc
+	}
+	r := []rune(doc)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// applySchemaTag applies the constraints in the jsonschema struct tag to the
+// schema. Constraints are separated by semicolons, e.g.
+// `jsonschema:"enum=a,b;default=a"`. Constraints of arrays and maps apply to
+// their items and keys respectively.
+func applySchemaTag(s *jsonSchema, tag string) error {
+	if tag == "" {
+		return nil
+	}
+	target := s
+	switch s.Type {
+	case "array":
+		target = s.Items
+	case "object":
+		if s.AdditionalProperties != false {
+			s.PropertyNames = &jsonSchema{}
+			target = s.PropertyNames
+		}
+	}
+	for _, c := range strings.Split(tag, ";") {
+		k, v, ok := strings.Cut(c, "=")
+		if !ok {
+			return fmt.Errorf("constraint %q is not of the form key=value", c)
+		}
+		switch k {
+		case "enum":
+			target.Enum = strings.Split(v, ",")
+		case "pattern":
+			target.Pattern = v
+		case "default":
+			target.Default = v
+		case "minimum", "maximum":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("parse %s: %w", k, err)
+			}
+			if k == "minimum" {
+				target.Minimum = &n
+			} else {
+				target.Maximum = &n
+			}
+		default:
+			return fmt.Errorf("unknown constraint %s", k)
+		}
+	}
+	return nil
+}
+
+// planSchemaRoot returns the schema of plans without descriptions.
+var planSchemaRoot = sync.OnceValue(func() *jsonSchema {
+	return generateSchema(nil)
+})
+
+// planSchema returns the compiled schema that plans are validated against.
+var planSchema = sync.OnceValues(func() (*jsonschema.Schema, error) {
+	b, err := json.Marshal(planSchemaRoot())
+	if err != nil {
+		return nil, fmt.Errorf("encode schema: %w", err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("decode schema: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(schemaID, doc); err != nil {
+		return nil, fmt.Errorf("add schema: %w", err)
+	}
+	return c.Compile(schemaID)
+})
+
+// SchemaError is a violation of the schema at a location in a plan.
+type SchemaError struct {
+	Path    string // Dot-separated path to the value, e.g. steps.0.script
+	Line    int    // Line of the value in the plan, or zero if unknown
+	Column  int    // Column of the value in the plan, or zero if unknown
+	Message string // Description of the violation
+}
+
+func (e *SchemaError) Error() string {
+	var loc []string
+	if e.Line > 0 {
+		loc = append(loc, fmt.Sprintf("%d:%d", e.Line, e.Column))
+	}
+	if e.Path != "" {
+		loc = append(loc, e.Path)
+	}
+	if len(loc) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(loc, ": "), e.Message)
+}
+
+// validateSchema validates the decoded plan against the schema. The parsed
+// document, which may be nil, is used to locate the violations.
+func validateSchema(v any, doc ast.Node) error {
+	sch, err := planSchema()
+	if err != nil {
+		return fmt.Errorf("compile schema: %w", err)
+	}
+	err = sch.Validate(v)
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	var errs []*SchemaError
+	for _, e := range schemaViolations(ve) {
+		se := &SchemaError{
+			Path:    strings.Join(e.InstanceLocation, "."),
+			Message: schemaMessage(e),
+		}
+		// NOTE: Unknown properties are located at their keys instead
+		loc := e.InstanceLocation
+		if k, ok := e.ErrorKind.(*kind.AdditionalProperties); ok && len(k.Properties) > 0 {
+			loc = append(slices.Clip(loc), k.Properties[0])
+		}
+		if pos := locateNode(doc, loc); pos != nil {
+			se.Line, se.Column = pos.Line, pos.Column
+		}
+		errs = append(errs, se)
+	}
+	slices.SortStableFunc(errs, func(a, b *SchemaError) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	joined := make([]error, 0, len(errs))
+	for _, e := range errs {
+		joined = append(joined, e)
+	}
+	return errors.Join(joined...)
+}
+
+// schemaKindMessage describes the kind of a violation in English.
+func schemaKindMessage(k jsonschema.ErrorKind) string {
+	// NOTE: The basic output of a violation without causes describes its kind
+	// with the default printer of the library
+	leaf := &jsonschema.ValidationError{ErrorKind: k}
+	return leaf.BasicOutput().Error.String()
+}
+
+// schemaViolations returns the innermost violations of the validation error.
+// Violations of oneOf and anyOf are reported as a whole, as their causes only
+// describe why each alternative did not match.
+func schemaViolations(e *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	switch e.ErrorKind.(type) {
+	case *kind.OneOf, *kind.AnyOf:
+		return []*jsonschema.ValidationError{e}
+	}
+	if len(e.Causes) == 0 {
+		return []*jsonschema.ValidationError{e}
+	}
+	var out []*jsonschema.ValidationError
+	for _, c := range e.Causes {
+		out = append(out, schemaViolations(c)...)
+	}
+	return out
+}
+
+// schemaMessage describes the violation. Alternatives of oneOf and anyOf that
+// only require a property, such as the operators of a step, are described by
+// the names of the properties.
+func schemaMessage(e *jsonschema.ValidationError) string {
+	var alts []*jsonSchema
+	switch e.ErrorKind.(type) {
+	case *kind.OneOf, *kind.AnyOf:
+		_, frag, _ := strings.Cut(e.SchemaURL, "#")
+		if s := planSchemaRoot().lookup(frag); s != nil {
+			alts = slices.Concat(s.OneOf, s.AnyOf)
+		}
+	default:
+		return schemaKindMessage(e.ErrorKind)
+	}
+
+	var names []string
+	for _, alt := range alts {
+		if len(alt.Required) != 1 || alt.Type != "" || alt.Properties != nil {
+			names = nil
+			break
+		}
+		names = append(names, alt.Required[0])
+	}
+	if k, ok := e.ErrorKind.(*kind.OneOf); ok && len(names) > 0 {
+		if len(k.Subschemas) == 0 {
+			return fmt.Sprintf("missing one of properties %s", quoteJoin(names))
+		}
+		matched := make([]string, 0, len(k.Subschemas))
+		for _, i := range k.Subschemas {
+			matched = append(matched, names[i])
+		}
+		return fmt.Sprintf("only one of properties %s is allowed", quoteJoin(matched))
+	}
+
+	// NOTE: Otherwise the value must satisfy any of the alternatives
+	var msgs []string
+	for _, c := range e.Causes {
+		for _, v := range schemaViolations(c) {
+			msgs = append(msgs, schemaMessage(v))
+		}
+	}
+	if len(msgs) == 0 {
+		return schemaKindMessage(e.ErrorKind)
+	}
+	return strings.Join(msgs, ", or ")
+}
+
+// lookup returns the subschema at the JSON pointer, or nil if there is none.
+func (s *jsonSchema) lookup(ptr string) *jsonSchema {
+	segs := strings.Split(strings.TrimPrefix(ptr, "/"), "/")
+	if ptr == "" {
+		segs = nil
+	}
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i := 0; s != nil && i < len(segs); i++ {
+		switch seg := segs[i]; seg {
+		case "properties", "$defs", "oneOf", "anyOf":
+			if i++; i >= len(segs) {
+				return nil
+			}
+			name := unescape.Replace(segs[i])
+			switch seg {
+			case "properties":
+				s = s.Properties.get(name)
+			case "$defs":
+				s = s.Defs[name]
+			default:
+				alts := s.OneOf
+				if seg == "anyOf" {
+					alts = s.AnyOf
+				}
+				n, err := strconv.Atoi(name)
+				if err != nil || n < 0 || n >= len(alts) {
+					return nil
+				}
+				s = alts[n]
+			}
+		case "items":
+			s = s.Items
+		case "propertyNames":
+			s = s.PropertyNames
+		case "additionalProperties":
+			s, _ = s.AdditionalProperties.(*jsonSchema)
+		default:
+			return nil
+		}
+	}
+	return s
+}
+
+// quoteJoin returns the names quoted and separated by commas, as in the
+// messages of the validator.
+func quoteJoin(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		quoted = append(quoted, "'"+n+"'")
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// locateNode returns the position of the value at the path in the document,
+// or of the closest ancestor that can be found. Values of mappings are located
+// at their keys.
+func locateNode(doc ast.Node, path []string) *token.Position {
+	node := unwrapNode(doc)
+	pos := nodePosition(node)
+	for _, seg := range path {
+		var values []*ast.MappingValueNode
+		switch n := node.(type) {
+		case *ast.MappingNode:
+			values = n.Values
+		case *ast.MappingValueNode:
+			values = []*ast.MappingValueNode{n}
+		case *ast.SequenceNode:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(n.Values) {
+				return pos
+			}
+			node = unwrapNode(n.Values[i])
+			pos = nodePosition(node)
+			continue
+		default:
+			return pos
+		}
+		i := slices.IndexFunc(values, func(mv *ast.MappingValueNode) bool {
+			return mv.Key.GetToken().Value == seg
+		})
+		if i < 0 {
+			return pos
+		}
+		node = unwrapNode(values[i].Value)
+		pos = values[i].Key.GetToken().Position
+	}
+	return pos
+}
+
+// nodePosition returns the position of the node, which is the position of the
+// first key for mappings.
+func nodePosition(node ast.Node) *token.Position {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *ast.MappingNode:
+		if len(n.Values) > 0 && !n.IsFlowStyle {
+			return n.Values[0].Key.GetToken().Position
+		}
+	case *ast.MappingValueNode:
+		return n.Key.GetToken().Position
+	}
+	if tk := node.GetToken(); tk != nil {
+		return tk.Position
+	}
+	return nil
+}
+
+// unwrapNode returns the node that is tagged or anchored by the node.
+func unwrapNode(node ast.Node) ast.Node {
+	for {
+		switch n := node.(type) {
+		case *ast.TagNode:
+			node = n.Value
+		case *ast.AnchorNode:
+			node = n.Value
+		default:
+			return node
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the generated schema file")
+
+// schemaFile is the schema file that is generated from the plan types.
+const schemaFile = "../../schema/bulk-v0.json"
+
+func TestSchema(t *testing.T) {
+	docs, err := parseDocs(".")
+	if err != nil {
+		t.Fatalf("failed to parse docs: %v", err)
+	}
+	got, err := json.MarshalIndent(generateSchema(docs), "", "    ")
+	if err != nil {
+		t.Fatalf("failed to encode schema: %v", err)
+	}
+	got = append(got, '\n')
+	if *update {
+		if err := os.WriteFile(schemaFile, got, 0644); err != nil {
+			t.Fatalf("failed to write schema: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(schemaFile)
+	if err != nil {
+		t.Fatalf("failed to read schema: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date, run `make schema` to update it", schemaFile)
+	}
+}
+
+// parseDocs returns the doc comments of the types and struct fields declared
+// in the package dir, keyed as expected by schemaGenerator.
+func parseDocs(dir string) (map[string]string, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	docs := map[string]string{}
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				docs[ts.Name.Name] = docText(doc)
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				for _, field := range st.Fields.List {
+					for _, n := range field.Names {
+						docs[ts.Name.Name+"."+n.Name] = docText(field.Doc)
+					}
+				}
+			}
+		}
+	}
+	return docs, nil
+}
+
+// docText returns the text of the comment joined into a single line.
+func docText(c *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(c.Text()), " ")
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "  sh -e {0}  ", want: []string{"sh", "-e", "{0}"}},
+		{input: `"/opt/my tools/sh" {0}`, want: []string{"/opt/my tools/sh", "{0}"}},
+		{input: `pwsh -command ". '{0}'"`, want: []string{"pwsh", "-command", ". '{0}'"}},
+		{input: `sh -c 'echo "$0"' {0}`, want: []string{"sh", "-c", `echo "$0"`, "{0}"}},
+		{input: `my\ shell {0}`, want: []string{"my shell", "{0}"}},
+		{input: `a"b"'c' "" {0}`, want: []string{"abc", "", "{0}"}},
+		{input: `"a\"b\c" {0}`, want: []string{`a"b\c`, "{0}"}},
+		{input: `sh 'unterminated {0}`, wantErr: true},
+		{input: `sh {0} \`, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := splitShellWords(tc.input)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("unexpected words: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOperatorExecScriptShell(t *testing.T) {
+	cases := []struct {
+		shell string
+		want  []string // Arguments of the shell, or nil if it is invalid
+	}{
+		{shell: "", want: []string{"bash", "--noprofile", "--norc", "-euo", "pipefail", "s.sh"}},
+		{shell: "sh", want: []string{"sh", "-e", "s.sh"}},
+		{shell: `"/opt/my shell/bin/sh" -c ". '{0}'"`, want: []string{"/opt/my shell/bin/sh", "-c", ". 's.sh'"}},
+		{shell: "fish"},
+		{shell: "{0} arg"},
+		{shell: `"" {0}`},
+		{shell: "sh '{0}"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.shell, func(t *testing.T) {
+			op := OperatorExecScript{Run: "true", Shell: tc.shell}
+			err := op.Validate()
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("expected error for shell %q", tc.shell)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to validate: %v", err)
+			}
+			sh, _ := op.shell()
+			if got := sh.args("s.sh"); !slices.Equal(got, tc.want) {
+				t.Errorf("unexpected args: got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
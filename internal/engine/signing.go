@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	signingFormatOpenPGP = "openpgp"
+	signingFormatSSH     = "ssh"
+	signingFormatX509    = "x509"
+)
+
+// signingCheckTimeout is the time allowed for the signer to sign without
+// interaction, after which it is assumed to be waiting for input.
+const signingCheckTimeout = 30 * time.Second
+
+type CommitSigning struct {
+	// Format of the signature: openpgp for GPG, ssh, or x509 for S/MIME and
+	// sigstore (gitsign).
+	Format string `json:"format" jsonschema:"enum=openpgp,ssh,x509"`
+	// Key used to sign, as set in user.signingKey. A key id for openpgp, or
+	// the path to a key or a literal key prefixed with key:: for ssh.
+	Key string `json:"key,omitempty"`
+	// Program used to sign, e.g. gpg, ssh-keygen or gitsign. Defaults to that
+	// of Git for the format.
+	Program string `json:"program,omitempty"`
+}
+
+func (s *CommitSigning) Validate() error {
+	switch s.Format {
+	case signingFormatOpenPGP, signingFormatX509:
+	case signingFormatSSH:
+		if s.Key == "" {
+			return fmt.Errorf("key must be specified for %s", s.Format)
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", s.Format)
+	}
+	return nil
+}
+
+// gitConfig returns the Git configuration that signs commits, as pairs of
+// keys and values.
+func (s *CommitSigning) gitConfig() [][2]string {
+	config := [][2]string{
+		{"commit.gpgSign", "true"},
+		{"gpg.format", s.Format},
+	}
+	if s.Key != "" {
+		config = append(config, [2]string{"user.signingKey", s.Key})
+	}
+	if s.Program != "" {
+		// NOTE: The program of openpgp is not namespaced for compatibility
+		key := "gpg.program"
+		if s.Format != signingFormatOpenPGP {
+			key = fmt.Sprintf("gpg.%s.program", s.Format)
+		}
+		config = append(config, [2]string{key, s.Program})
+	}
+	return config
+}
+
+// signingConfig returns the Git configuration of the worktrees for the
+// signing of the commit, or nil to keep the configured behaviour. Signing is
+// disabled if requested, regardless of the plan.
+func signingConfig(commit Commit, disabled bool) [][2]string {
+	if disabled {
+		return [][2]string{{"commit.gpgSign", "false"}}
+	}
+	if commit.Signing == nil {
+		return nil
+	}
+	return commit.Signing.gitConfig()
+}
+
+// checkSigning checks that commits can be signed without interaction, by
+// committing in a scratch repository without a terminal. Prompts of signers
+// would otherwise stall or fail each repository that is processed.
+func checkSigning(commit Commit, disabled bool) error {
+	if disabled {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "bulk-signing-")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), signingCheckTimeout)
+	defer cancel()
+	git := func(args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		c := exec.CommandContext(ctx, "git", args...)
+		c.Dir = dir
+		c.Stdout = &stdout
+		c.Stderr = &stderr
+		// NOTE: Signers prompt on the terminal or through askpass programs,
+		// which are all made unavailable
+		c.Env = append(signingEnv(), "GIT_TERMINAL_PROMPT=0", "SSH_ASKPASS_REQUIRE=never")
+		detachTerminal(c)
+		if err := c.Run(); err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", fmt.Errorf("timed out after %s waiting for input", signingCheckTimeout)
+			}
+			return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+
+	if _, err := git("init", "--quiet", "."); err != nil {
+		return fmt.Errorf("init repo: %w", err)
+	}
+	for _, kv := range signingConfig(commit, false) {
+		if _, err := git("config", "--local", kv[0], kv[1]); err != nil {
+			return fmt.Errorf("set %s: %w", kv[0], err)
+		}
+	}
+	if enabled, _ := git("config", "--bool", "commit.gpgSign"); enabled != "true" {
+		return nil
+	}
+	// NOTE: A missing identity would otherwise fail the commit below, and be
+	// reported as a problem of the signer
+	var idents []string
+	if commit.Author == nil {
+		idents = append(idents, "GIT_AUTHOR_IDENT")
+		if commit.Committer == nil {
+			idents = append(idents, "GIT_COMMITTER_IDENT")
+		}
+	}
+	for _, v := range idents {
+		if _, err := git("var", v); err != nil {
+			return fmt.Errorf("check identity, set user.name and user.email in Git or the author of the plan: %w", err)
+		}
+	}
+	args := commitArgs("check", Commit{
+		Title:     "Check commit signing",
+		Body:      "This commit is discarded.",
+		Author:    commit.Author,
+		Committer: commit.Committer,
+	})
+	args = append(args, "--allow-empty", "--quiet")
+	if _, err := git(args...); err != nil {
+		return fmt.Errorf("sign commit without interaction, unlock the key beforehand or use --no-sign: %w", err)
+	}
+	return nil
+}
+
+// signingEnv returns the environment of the process without the variables
+// that let signers prompt on a terminal.
+func signingEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if k, _, _ := strings.Cut(kv, "="); k == "GPG_TTY" {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
@@ -0,0 +1,82 @@
+//go:build integration && unix
+
+package engine
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSigning(t *testing.T) {
+	// NOTE: The configuration of the machine must not affect the check
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("EMAIL", "")
+
+	dir := t.TempDir()
+	keygen := func(name, passphrase string) string {
+		t.Helper()
+		key := filepath.Join(dir, name)
+		if o, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", passphrase, "-f", key).CombinedOutput(); err != nil {
+			t.Fatalf("failed to generate key: %v: %s", err, o)
+		}
+		return key
+	}
+	author := &CommitIdentity{Name: "Bulk Bot", Email: "bot@example.com"}
+
+	cases := []struct {
+		name     string
+		signing  *CommitSigning
+		author   *CommitIdentity
+		disabled bool
+		err      string
+	}{
+		{
+			name: "not signed",
+		},
+		{
+			name:    "unencrypted key",
+			signing: &CommitSigning{Format: signingFormatSSH, Key: keygen("plain", "")},
+			author:  author,
+		},
+		{
+			name:    "no identity",
+			signing: &CommitSigning{Format: signingFormatSSH, Key: filepath.Join(dir, "plain")},
+			err:     "check identity",
+		},
+		{
+			name:    "encrypted key",
+			signing: &CommitSigning{Format: signingFormatSSH, Key: keygen("secret", "secret")},
+			author:  author,
+			err:     "sign commit without interaction",
+		},
+		{
+			name:     "disabled",
+			signing:  &CommitSigning{Format: signingFormatSSH, Key: filepath.Join(dir, "secret")},
+			disabled: true,
+		},
+		{
+			name:    "failing program",
+			signing: &CommitSigning{Format: signingFormatOpenPGP, Program: "false"},
+			author:  author,
+			err:     "sign commit without interaction",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkSigning(Commit{Author: tc.author, Signing: tc.signing}, tc.disabled)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("failed to check signing: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("unexpected error: got %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
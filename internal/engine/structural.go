@@ -0,0 +1,473 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// structuralSyntax describes the lexical features of a language that are
+// needed to match holes structurally.
+type structuralSyntax struct {
+	delims        map[byte]byte // Opening to closing delimiters
+	quotes        []byte        // String delimiters
+	multiline     []byte        // String delimiters that may span lines
+	lineComments  []string      // Line comment prefixes
+	blockComments [][2]string   // Block comment start and end markers
+}
+
+var (
+	structuralSyntaxBrace = structuralSyntax{
+		delims:        map[byte]byte{'(': ')', '[': ']', '{': '}'},
+		quotes:        []byte{'"', '\'', '`'},
+		multiline:     []byte{'`'},
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+	}
+	structuralSyntaxHash = structuralSyntax{
+		delims:       map[byte]byte{'(': ')', '[': ']', '{': '}'},
+		quotes:       []byte{'"', '\''},
+		lineComments: []string{"#"},
+	}
+	structuralSyntaxJSON = structuralSyntax{
+		delims: map[byte]byte{'[': ']', '{': '}'},
+		quotes: []byte{'"'},
+	}
+)
+
+// structuralLanguages maps the supported languages to their syntax.
+var structuralLanguages = map[string]structuralSyntax{
+	"generic":    structuralSyntaxBrace,
+	"c":          structuralSyntaxBrace,
+	"cpp":        structuralSyntaxBrace,
+	"csharp":     structuralSyntaxBrace,
+	"go":         structuralSyntaxBrace,
+	"java":       structuralSyntaxBrace,
+	"javascript": structuralSyntaxBrace,
+	"kotlin":     structuralSyntaxBrace,
+	"rust":       structuralSyntaxBrace,
+	"scala":      structuralSyntaxBrace,
+	"swift":      structuralSyntaxBrace,
+	"typescript": structuralSyntaxBrace,
+	"python":     structuralSyntaxHash,
+	"ruby":       structuralSyntaxHash,
+	"shell":      structuralSyntaxHash,
+	"toml":       structuralSyntaxHash,
+	"yaml":       structuralSyntaxHash,
+	"json":       structuralSyntaxJSON,
+}
+
+// structuralExtensions maps file extensions to languages when the language is
+// not explicitly specified. Unknown extensions use the generic language.
+var structuralExtensions = map[string]string{
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".go":    "go",
+	".java":  "java",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".kt":    "kotlin",
+	".rs":    "rust",
+	".scala": "scala",
+	".swift": "swift",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".py":    "python",
+	".rb":    "ruby",
+	".sh":    "shell",
+	".bash":  "shell",
+	".toml":  "toml",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".json":  "json",
+}
+
+func structuralLanguageOf(name string) string {
+	if l, ok := structuralExtensions[strings.ToLower(filepath.Ext(name))]; ok {
+		return l
+	}
+	return "generic"
+}
+
+type structuralKind int
+
+const (
+	structuralLiteral structuralKind = iota
+	structuralSpace
+	structuralHole
+	structuralIdentHole
+)
+
+type structuralElem struct {
+	kind     structuralKind
+	text     string // Literal text or name of the hole
+	required bool   // Whether whitespace is required, i.e. between words
+}
+
+// structuralPattern is a parsed match template, where `:[name]` holes match
+// balanced text and `:[[name]]` holes match identifier characters.
+type structuralPattern struct {
+	elems []structuralElem
+	holes map[string]struct{}
+}
+
+// parseStructuralPattern parses a match template. Whitespace in the template
+// matches any amount of whitespace, and is required only between words.
+func parseStructuralPattern(s string) (*structuralPattern, error) {
+	p := &structuralPattern{holes: make(map[string]struct{})}
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			p.elems = append(p.elems, structuralElem{kind: structuralLiteral, text: lit.String()})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		if name, kind, n, err := parseStructuralHole(s[i:]); err != nil {
+			return nil, fmt.Errorf("parse hole at offset %d: %w", i, err)
+		} else if n > 0 {
+			flush()
+			p.elems = append(p.elems, structuralElem{kind: kind, text: name})
+			if name != "_" {
+				p.holes[name] = struct{}{}
+			}
+			i += n
+			continue
+		}
+		if isStructuralSpace(s[i]) {
+			flush()
+			j := i
+			for j < len(s) && isStructuralSpace(s[j]) {
+				j++
+			}
+			p.elems = append(p.elems, structuralElem{kind: structuralSpace})
+			i = j
+			continue
+		}
+		lit.WriteByte(s[i])
+		i++
+	}
+	flush()
+	if len(p.elems) == 0 {
+		return nil, fmt.Errorf("pattern is empty")
+	}
+
+	// NOTE: Whitespace can only be omitted where it does not join words
+	for i, e := range p.elems {
+		if e.kind != structuralSpace || i == 0 || i == len(p.elems)-1 {
+			continue
+		}
+		prev, next := p.elems[i-1], p.elems[i+1]
+		p.elems[i].required = prev.kind == structuralLiteral && next.kind == structuralLiteral &&
+			isStructuralWord(prev.text[len(prev.text)-1]) && isStructuralWord(next.text[0])
+	}
+	return p, nil
+}
+
+// parseStructuralHole parses the hole at the start of s, returning the number
+// of bytes consumed or zero if s does not start with a hole.
+func parseStructuralHole(s string) (name string, kind structuralKind, n int, err error) {
+	if !strings.HasPrefix(s, ":[") {
+		return "", 0, 0, nil
+	}
+	open, close, kind := ":[", "]", structuralHole
+	if strings.HasPrefix(s, ":[[") {
+		open, close, kind = ":[[", "]]", structuralIdentHole
+	}
+	end := strings.Index(s[len(open):], close)
+	if end == -1 {
+		return "", 0, 0, fmt.Errorf("hole is not terminated")
+	}
+	name = s[len(open) : len(open)+end]
+	if name == "" {
+		return "", 0, 0, fmt.Errorf("hole name is empty")
+	}
+	for i := 0; i < len(name); i++ {
+		if !isStructuralWord(name[i]) {
+			return "", 0, 0, fmt.Errorf("hole name %s must only contain word characters", name)
+		}
+	}
+	return name, kind, len(open) + end + len(close), nil
+}
+
+// structuralSource is the text being matched along with its precomputed
+// lexical structure.
+type structuralSource struct {
+	text      string
+	regionEnd map[int]int  // Start of strings and comments to their end
+	comments  map[int]bool // Start of comments
+	closing   map[int]int  // Opening delimiters to their closing delimiter
+	inRegion  []bool       // Whether the offset is within a string or comment
+}
+
+func newStructuralSource(text string, syn structuralSyntax) *structuralSource {
+	src := &structuralSource{
+		text:      text,
+		regionEnd: make(map[int]int),
+		comments:  make(map[int]bool),
+		closing:   make(map[int]int),
+		inRegion:  make([]bool, len(text)+1),
+	}
+
+	var stack []int
+	for i := 0; i < len(text); {
+		if end, comment := syn.regionAt(text, i); end > i {
+			src.regionEnd[i] = end
+			src.comments[i] = comment
+			for j := i + 1; j < end; j++ {
+				src.inRegion[j] = true
+			}
+			i = end
+			continue
+		}
+		c := text[i]
+		if _, ok := syn.delims[c]; ok {
+			stack = append(stack, i)
+		} else if len(stack) > 0 && syn.delims[text[stack[len(stack)-1]]] == c {
+			src.closing[stack[len(stack)-1]] = i
+			stack = stack[:len(stack)-1]
+		}
+		i++
+	}
+	return src
+}
+
+// regionAt returns the end of the string or comment starting at offset i, or
+// zero if there is none, and whether it is a comment.
+func (syn structuralSyntax) regionAt(text string, i int) (int, bool) {
+	for _, c := range syn.blockComments {
+		if strings.HasPrefix(text[i:], c[0]) {
+			if end := strings.Index(text[i+len(c[0]):], c[1]); end != -1 {
+				return i + len(c[0]) + end + len(c[1]), true
+			}
+			return len(text), true
+		}
+	}
+	for _, c := range syn.lineComments {
+		if strings.HasPrefix(text[i:], c) {
+			if end := strings.IndexByte(text[i:], '\n'); end != -1 {
+				return i + end, true
+			}
+			return len(text), true
+		}
+	}
+	q := text[i]
+	if strings.IndexByte(string(syn.quotes), q) == -1 {
+		return 0, false
+	}
+	multiline := strings.IndexByte(string(syn.multiline), q) != -1
+	for j := i + 1; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '\n':
+			// NOTE: An unterminated quote is more likely to be an
+			// apostrophe than a string, so it is treated as code.
+			if !multiline {
+				return 0, false
+			}
+		case q:
+			return j + 1, false
+		}
+	}
+	return 0, false
+}
+
+// next returns the offset after the structural unit starting at i, or -1 if
+// a hole cannot extend past i, i.e. at an unbalanced delimiter.
+func (src *structuralSource) next(i int, syn structuralSyntax) int {
+	if end, ok := src.regionEnd[i]; ok {
+		return end
+	}
+	c := src.text[i]
+	if _, ok := syn.delims[c]; ok {
+		if end, ok := src.closing[i]; ok {
+			return end + 1
+		}
+		return -1
+	}
+	for _, close := range syn.delims {
+		if c == close {
+			return -1
+		}
+	}
+	return i + 1
+}
+
+type structuralMatcher struct {
+	pattern *structuralPattern
+	src     *structuralSource
+	syn     structuralSyntax
+}
+
+type structuralMatch struct {
+	start, end int
+	binds      map[string]string
+}
+
+// findAll returns the non-overlapping matches of the pattern in the source.
+func (m *structuralMatcher) findAll() []structuralMatch {
+	var matches []structuralMatch
+	for i := 0; i < len(m.src.text); {
+		if m.src.inRegion[i] {
+			i++
+			continue
+		}
+		binds := make(map[string]string)
+		if end, ok := m.match(0, i, binds); ok && end > i {
+			matches = append(matches, structuralMatch{start: i, end: end, binds: binds})
+			i = end
+			continue
+		}
+		i++
+	}
+	return matches
+}
+
+// match matches the pattern elements from pi onwards at offset si, returning
+// the end offset of the match.
+func (m *structuralMatcher) match(pi, si int, binds map[string]string) (int, bool) {
+	if pi == len(m.pattern.elems) {
+		return si, true
+	}
+	text := m.src.text
+	e := m.pattern.elems[pi]
+	switch e.kind {
+	case structuralLiteral:
+		if !strings.HasPrefix(text[si:], e.text) {
+			return 0, false
+		}
+		return m.match(pi+1, si+len(e.text), binds)
+
+	case structuralSpace:
+		j := si
+		for j < len(text) && isStructuralSpace(text[j]) {
+			j++
+		}
+		if e.required && j == si {
+			return 0, false
+		}
+		return m.match(pi+1, j, binds)
+
+	case structuralIdentHole:
+		j := si
+		for j < len(text) && isStructuralWord(text[j]) {
+			j++
+		}
+		if j == si {
+			return 0, false
+		}
+		return m.bind(pi, si, j, binds)
+
+	case structuralHole:
+		if v, ok := binds[e.text]; ok && e.text != "_" {
+			if !strings.HasPrefix(text[si:], v) {
+				return 0, false
+			}
+			return m.match(pi+1, si+len(v), binds)
+		}
+
+		// NOTE: A trailing hole has nothing to stop it, so it greedily
+		// matches to the end of the line instead, excluding any comment.
+		if pi == len(m.pattern.elems)-1 {
+			j := si
+			for j < len(text) && text[j] != '\n' && !m.src.comments[j] {
+				n := m.src.next(j, m.syn)
+				if n < 0 {
+					break
+				}
+				j = n
+			}
+			for j > si && isStructuralSpace(text[j-1]) {
+				j--
+			}
+			return m.bind(pi, si, j, binds)
+		}
+
+		// NOTE: Holes are lazy and only end on structural boundaries, so
+		// they never split a string, comment or delimited block.
+		for j := si; ; {
+			if end, ok := m.bind(pi, si, j, binds); ok {
+				return end, true
+			}
+			if j >= len(text) {
+				return 0, false
+			}
+			if j = m.src.next(j, m.syn); j < 0 {
+				return 0, false
+			}
+		}
+	}
+	return 0, false
+}
+
+func (m *structuralMatcher) bind(pi, start, end int, binds map[string]string) (int, bool) {
+	name := m.pattern.elems[pi].text
+	if name == "_" {
+		return m.match(pi+1, end, binds)
+	}
+	if v, ok := binds[name]; ok {
+		if v != m.src.text[start:end] {
+			return 0, false
+		}
+		return m.match(pi+1, end, binds)
+	}
+	binds[name] = m.src.text[start:end]
+	if end, ok := m.match(pi+1, end, binds); ok {
+		return end, true
+	}
+	delete(binds, name)
+	return 0, false
+}
+
+// structuralReplaceAll replaces all matches of the pattern in text with the
+// rewrite template, substituting holes with their matched text.
+func structuralReplaceAll(text string, syn structuralSyntax, pattern *structuralPattern, rewrite string) string {
+	m := &structuralMatcher{
+		pattern: pattern,
+		src:     newStructuralSource(text, syn),
+		syn:     syn,
+	}
+	matches := m.findAll()
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		b.WriteString(text[last:match.start])
+		b.WriteString(substituteStructuralHoles(rewrite, match.binds))
+		last = match.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func substituteStructuralHoles(tmpl string, binds map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(tmpl); {
+		if name, _, n, err := parseStructuralHole(tmpl[i:]); err == nil && n > 0 {
+			b.WriteString(binds[name])
+			i += n
+			continue
+		}
+		b.WriteByte(tmpl[i])
+		i++
+	}
+	return b.String()
+}
+
+func isStructuralSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isStructuralWord(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,75 @@
+package engine
+
+import "testing"
+
+func TestStructuralReplaceAll(t *testing.T) {
+	cases := []struct {
+		name    string
+		lang    string
+		text    string
+		match   string
+		rewrite string
+		want    string
+	}{
+		{
+			name:    "balanced holes",
+			lang:    "javascript",
+			text:    "foo(bar(1, 2), [3, 4])\n",
+			match:   "foo(:[a], :[b])",
+			rewrite: "foo(:[b], :[a])",
+			want:    "foo([3, 4], bar(1, 2))\n",
+		},
+		{
+			name:    "skips strings and comments",
+			lang:    "go",
+			text:    "f(\"a)b\") // f(c)\ns := \"f(d)\"\n",
+			match:   "f(:[x])",
+			rewrite: "g(:[x])",
+			want:    "g(\"a)b\") // f(c)\ns := \"f(d)\"\n",
+		},
+		{
+			name:    "flexible whitespace",
+			lang:    "c",
+			text:    "if (x)\n{\n\treturn;\n}\n",
+			match:   "if (:[c]) { :[body] }",
+			rewrite: "if (!(:[c])) { :[body] }",
+			want:    "if (!(x)) { return; }\n",
+		},
+		{
+			name:    "repeated holes",
+			lang:    "go",
+			text:    "a == a && a == b\n",
+			match:   ":[[x]] == :[[x]]",
+			rewrite: "true",
+			want:    "true && a == b\n",
+		},
+		{
+			name:    "trailing hole preserves comment",
+			lang:    "yaml",
+			text:    "image: node:18 # pinned\n",
+			match:   "image: node::[v]",
+			rewrite: "image: node:20",
+			want:    "image: node:20 # pinned\n",
+		},
+		{
+			name:    "json values",
+			lang:    "json",
+			text:    `{"a": {"b": [1, 2]}, "c": 3}`,
+			match:   `"a": :[v],`,
+			rewrite: `"a": null,`,
+			want:    `{"a": null, "c": 3}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := parseStructuralPattern(tc.match)
+			if err != nil {
+				t.Fatalf("failed to parse pattern: %v", err)
+			}
+			got := structuralReplaceAll(tc.text, structuralLanguages[tc.lang], p, tc.rewrite)
+			if got != tc.want {
+				t.Errorf("unexpected output:\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
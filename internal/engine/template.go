@@ -2,12 +2,33 @@ package engine
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"text/template"
+	"text/template/parse"
 )
 
 type TemplateContext struct {
-	Plan Plan
+	Plan       Plan
+	Repository RepositoryContext
+}
+
+// RepositoryContext describes the repository that is being processed.
+type RepositoryContext struct {
+	Name  string `json:"name"`  // Full name of the repository in owner/repo form
+	Owner string `json:"owner"` // Owner of the repository
+	Repo  string `json:"repo"`  // Name of the repository without the owner
+}
+
+func NewRepositoryContext(name string) RepositoryContext {
+	owner, repo, _ := strings.Cut(name, "/")
+	return RepositoryContext{
+		Name:  name,
+		Owner: owner,
+		Repo:  repo,
+	}
 }
 
 func (t *TemplateContext) RenderString(s string) (string, error) {
@@ -21,3 +42,103 @@ func (t *TemplateContext) RenderString(s string) (string, error) {
 	}
 	return b.String(), nil
 }
+
+// checkTemplate parses the template and checks that the fields that it
+// references exist in the template context. Every template of a plan is
+// rendered for each repository, so the whole context is available to it.
+func checkTemplate(s string) error {
+	tpl, err := template.New("field").Parse(s)
+	if err != nil {
+		return fmt.Errorf("parse template: %w", err)
+	}
+	root := reflect.TypeFor[TemplateContext]()
+	return checkTemplateNode(tpl.Root, root, root)
+}
+
+// checkTemplateNode checks the fields referenced by the node against the type
+// of dot and the root context. Dot is nil where its type is not known, such as
+// within range and with actions.
+func checkTemplateNode(node parse.Node, dot, root reflect.Type) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			if err := checkTemplateNode(c, dot, root); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkTemplateNode(n.Pipe, dot, root)
+	case *parse.TemplateNode:
+		return checkTemplateNode(n.Pipe, dot, root)
+	case *parse.IfNode:
+		return errors.Join(
+			checkTemplateNode(n.Pipe, dot, root),
+			checkTemplateNode(n.List, dot, root),
+			checkTemplateNode(n.ElseList, dot, root),
+		)
+	case *parse.RangeNode:
+		return errors.Join(
+			checkTemplateNode(n.Pipe, dot, root),
+			checkTemplateNode(n.List, nil, root),
+			checkTemplateNode(n.ElseList, dot, root),
+		)
+	case *parse.WithNode:
+		return errors.Join(
+			checkTemplateNode(n.Pipe, dot, root),
+			checkTemplateNode(n.List, nil, root),
+			checkTemplateNode(n.ElseList, dot, root),
+		)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := checkTemplateNode(arg, dot, root); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.FieldNode:
+		if dot != nil {
+			return checkTemplateField(dot, n.Ident)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			return checkTemplateField(root, n.Ident[1:])
+		}
+	}
+	return nil
+}
+
+// checkTemplateField checks that the chain of fields can be evaluated on the
+// type.
+func checkTemplateField(t reflect.Type, idents []string) error {
+	for i, id := range idents {
+		if m, ok := reflect.PointerTo(t).MethodByName(id); ok && m.Type.NumOut() > 0 {
+			t = m.Type.Out(0)
+			continue
+		}
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := t.FieldByName(id)
+			if !ok || !f.IsExported() {
+				return fmt.Errorf("unknown field .%s", strings.Join(idents[:i+1], "."))
+			}
+			t = f.Type
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Interface:
+			return nil
+		default:
+			return fmt.Errorf("cannot evaluate field .%s in type %s", strings.Join(idents[:i+1], "."), t)
+		}
+	}
+	return nil
+}
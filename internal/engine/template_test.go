@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckTemplate(t *testing.T) {
+	cases := []struct {
+		tpl string
+		err string
+	}{
+		{tpl: "plain text"},
+		{tpl: "{{ .Repository.Name }} {{ .Plan.Commit.Title }}"},
+		{tpl: "{{ range .Plan.Steps }}{{ .Anything }}{{ end }}"},
+		{tpl: "{{ with .Plan }}{{ $.Repository.Owner }}{{ end }}"},
+		{tpl: "{{ .Repository.Nme }}", err: "unknown field .Repository.Nme"},
+		{tpl: "{{ if .Repo }}x{{ end }}", err: "unknown field .Repo"},
+		{tpl: "{{ $.Plan.Bogus }}", err: "unknown field .Plan.Bogus"},
+		{tpl: "{{ .Plan.ID.Foo }}", err: "cannot evaluate field .Plan.ID.Foo"},
+		{tpl: "{{ .Plan", err: "parse template"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.tpl, func(t *testing.T) {
+			err := checkTemplate(tc.tpl)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("unexpected error: got %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
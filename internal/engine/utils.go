@@ -3,16 +3,24 @@ package engine
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
-func dirExecContext(ctx context.Context, dir, cmd string, args ...string) error {
+func dirExecContext(ctx context.Context, dir string, env []string, cmd string, args ...string) error {
 	// TODO: Should we not pipe stdout/err?
 	c := exec.CommandContext(ctx, cmd, args...)
 	c.Dir = dir
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 	if err := c.Run(); err != nil {
@@ -22,7 +30,7 @@ func dirExecContext(ctx context.Context, dir, cmd string, args ...string) error
 }
 
 func dirExec(dir, cmd string, args ...string) error {
-	return dirExecContext(context.Background(), dir, cmd, args...)
+	return dirExecContext(context.Background(), dir, nil, cmd, args...)
 }
 
 func promptConfirm(prompt string) (bool, error) {
@@ -44,3 +52,75 @@ func promptConfirm(prompt string) (bool, error) {
 		}
 	}
 }
+
+// validateRelativePath checks that a user-provided path is relative and does
+// not traverse out of the directory that it is relative to.
+func validateRelativePath(name string) error {
+	if filepath.IsAbs(name) {
+		return fmt.Errorf("path %s must be relative", name)
+	}
+	if c := filepath.Clean(name); c == ".." || strings.HasPrefix(c, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path %s must not traverse out of its root", name)
+	}
+	return nil
+}
+
+// resolvePath joins a relative path onto root and ensures that the result
+// does not escape root.
+func resolvePath(root, name string) (string, error) {
+	if err := validateRelativePath(name); err != nil {
+		return "", err
+	}
+	p := filepath.Join(root, name)
+	if err := ensureWithinDir(root, p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// ensureWithinDir checks that path p, after resolving any symlinks in its
+// existing ancestors, is located within root.
+func ensureWithinDir(root, p string) error {
+	r, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("resolve root: %w", err)
+	}
+
+	// NOTE: The path may not exist yet (e.g. a destination), so only the
+	// longest existing prefix of the path is resolved.
+	resolved, rest := filepath.Clean(p), ""
+	for {
+		rp, err := filepath.EvalSymlinks(resolved)
+		if err == nil {
+			resolved = filepath.Join(rp, rest)
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+		parent := filepath.Dir(resolved)
+		if parent == resolved {
+			break
+		}
+		rest = filepath.Join(filepath.Base(resolved), rest)
+		resolved = parent
+	}
+
+	rel, err := filepath.Rel(r, resolved)
+	if err != nil {
+		return fmt.Errorf("relative path: %w", err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path %s escapes %s", p, root)
+	}
+	return nil
+}
+
+// randomHex returns a random hex string of n bytes.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("read random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,300 @@
+package engine
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in a plan.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	loc := d.File
+	if d.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+	}
+	if d.Path == "" {
+		return fmt.Sprintf("%s: %s: %s", loc, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", loc, d.Severity, d.Path, d.Message)
+}
+
+// ValidateFile validates the plans in the file without applying them, which
+// is read from stdin if the name is -. All the problems that are found are
+// returned instead of only the first. An error is only returned if the file
+// cannot be read.
+func ValidateFile(name string) ([]Diagnostic, error) {
+	b, err := readPlanFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	v := &planValidator{name: name, format: planFormat(name, b), dir: "."}
+	if name == "-" {
+		v.name = "<stdin>"
+	} else {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return nil, fmt.Errorf("get absolute path: %w", err)
+		}
+		v.dir, v.file = filepath.Dir(abs), abs
+	}
+
+	// NOTE: JSON plans are also parsed as YAML to locate their problems
+	file, err := parser.ParseBytes(b, 0)
+	if err != nil {
+		d := Diagnostic{File: v.name, Severity: SeverityError, Message: err.Error()}
+		var yerr yaml.Error
+		if errors.As(err, &yerr) {
+			d.Message = yerr.GetMessage()
+			if tk := yerr.GetToken(); tk != nil {
+				d.Line, d.Column = tk.Position.Line, tk.Position.Column
+			}
+		}
+		return []Diagnostic{d}, nil
+	}
+	docs := yamlDocuments(file)
+	if len(docs) == 0 {
+		v.add("", SeverityError, errors.New("no plan found"))
+	}
+	for _, doc := range docs {
+		v.doc = doc
+		v.validate()
+	}
+	slices.SortStableFunc(v.diags, func(a, b Diagnostic) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	return v.diags, nil
+}
+
+// planValidator collects the diagnostics of the plans in a file.
+type planValidator struct {
+	name   string   // Name of the file
+	format string   // Format of the file
+	dir    string   // Directory that references are resolved relative to
+	file   string   // Absolute path of the file, or empty for stdin
+	doc    ast.Node // Document of the plan being validated
+	diags  []Diagnostic
+}
+
+func (v *planValidator) validate() {
+	value, err := yamlNodeToJSON(v.doc)
+	if err != nil {
+		v.add("", SeverityError, err)
+		return
+	}
+	// NOTE: The version is read before the plan is migrated while decoding
+	if m, ok := value.(map[string]any); ok {
+		if n, ok := m["version"].(json.Number); ok {
+			if from, err := n.Int64(); err == nil && from >= 0 && from < int64(LatestPlanVersion()) {
+				v.add("version", SeverityWarning, fmt.Errorf("plan version %d is outdated, run `bulk migrate` to migrate it to version %d", from, LatestPlanVersion()))
+			}
+		}
+	}
+	var stack []string
+	if v.file != "" {
+		stack = []string{v.file}
+	}
+	c := &planComposer{stack: stack}
+	p, err := c.decodePlan(value, v.doc, v.format, v.dir)
+	if isComposed(value) {
+		// NOTE: Problems of a composed plan cannot be located in any file
+		v.doc = nil
+	}
+
+	// NOTE: Values with schema violations are not checked again below, as
+	// their errors would only be repeated.
+	var invalid []string
+	if err != nil {
+		var ce *ComposeError
+		ses := schemaErrors(err)
+		switch {
+		case errors.As(err, &ce):
+			v.add(ce.Path, SeverityError, ce.Err)
+		case len(ses) > 0:
+			for _, se := range ses {
+				v.diags = append(v.diags, Diagnostic{
+					File:     v.name,
+					Line:     se.Line,
+					Column:   se.Column,
+					Path:     se.Path,
+					Severity: SeverityError,
+					Message:  se.Message,
+				})
+				invalid = append(invalid, se.Path)
+			}
+		default:
+			v.add("", SeverityError, err)
+		}
+	}
+	if p == nil {
+		return
+	}
+	isInvalid := func(path string) bool {
+		return slices.ContainsFunc(invalid, func(p string) bool {
+			return p != "" && (p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+"."))
+		})
+	}
+	for _, prob := range p.problems(isInvalid) {
+		v.add(prob.path, prob.severity, prob.err)
+	}
+}
+
+// schemaErrors returns the schema violations that the error consists of.
+func schemaErrors(err error) []*SchemaError {
+	errs := []error{err}
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		errs = joined.Unwrap()
+	}
+	var ses []*SchemaError
+	for _, err := range errs {
+		var se *SchemaError
+		if errors.As(err, &se) {
+			ses = append(ses, se)
+		}
+	}
+	return ses
+}
+
+// planProblem is a problem of a decoded plan at the dot-separated path of its
+// value.
+type planProblem struct {
+	path     string
+	severity string
+	err      error
+}
+
+func (e planProblem) Error() string {
+	if e.path == "" {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.path, e.err)
+}
+
+func (e planProblem) Unwrap() error {
+	return e.err
+}
+
+// problems checks the decoded plan beyond its schema, and returns all of its
+// problems instead of only the first. Values at the paths that skip reports
+// are not checked, such as those that already violate the schema.
+func (p *Plan) problems(skip func(path string) bool) []planProblem {
+	var probs []planProblem
+	add := func(path, severity string, err error) {
+		probs = append(probs, planProblem{path: path, severity: severity, err: err})
+	}
+	if !skip("id") {
+		if err := validatePlanID(p.ID); err != nil {
+			add("id", SeverityError, err)
+		}
+	}
+	if !skip("commit") {
+		if err := p.Commit.Validate(); err != nil {
+			add("commit", SeverityError, err)
+		}
+	}
+	if !skip("checkout") {
+		if err := p.Checkout.Validate(); err != nil {
+			add("checkout", SeverityError, err)
+		}
+	}
+	if len(p.On.Repositories) == 0 && p.On.RepositoriesMatch.Search == "" {
+		add("on", SeverityError, errors.New("no repositories or repositoriesMatch.search specified"))
+	}
+	seen := make(map[string]int, len(p.On.Repositories))
+	for i, r := range p.On.Repositories {
+		// NOTE: Repository names are case-insensitive on GitHub
+		k := strings.ToLower(r)
+		if j, ok := seen[k]; ok {
+			add(fmt.Sprintf("on.repositories.%d", i), SeverityWarning, fmt.Errorf("repository %s is already specified at on.repositories.%d", r, j))
+			continue
+		}
+		seen[k] = i
+	}
+	for i, c := range p.On.Where {
+		path := fmt.Sprintf("on.where.%d", i)
+		if skip(path) {
+			continue
+		}
+		if err := c.Validate(); err != nil {
+			add(path, SeverityError, err)
+			continue
+		}
+		if c.Expr != "" {
+			if err := checkTemplate(c.Expr); err != nil {
+				add(path+".expr", SeverityError, err)
+			}
+		}
+	}
+	for i, step := range p.Steps {
+		path := fmt.Sprintf("steps.%d", i)
+		if skip(path) {
+			continue
+		}
+		if err := step.Validate(); err != nil {
+			add(path, SeverityError, err)
+			continue
+		}
+		if step.If != nil && step.If.Expr != "" {
+			if err := checkTemplate(step.If.Expr); err != nil {
+				add(path+".if.expr", SeverityError, err)
+			}
+		}
+		if _, ok := step.Operator.(targeter); !ok && p.Checkout.SparseTargets {
+			add(path, SeverityWarning, errNoTargets)
+		}
+	}
+	fields, err := p.templateFields()
+	if err != nil {
+		add("", SeverityError, err)
+		return probs
+	}
+	for _, f := range fields {
+		if skip(f.path) {
+			continue
+		}
+		if err := checkTemplate(*f.value); err != nil {
+			add(f.path, SeverityError, err)
+		}
+	}
+	return probs
+}
+
+// add adds a diagnostic for the error at the path of the plan.
+func (v *planValidator) add(path, severity string, err error) {
+	d := Diagnostic{
+		File:     v.name,
+		Path:     path,
+		Severity: severity,
+		Message:  err.Error(),
+	}
+	var segs []string
+	if path != "" {
+		segs = strings.Split(path, ".")
+	}
+	if pos := locateNode(v.doc, segs); pos != nil {
+		d.Line, d.Column = pos.Line, pos.Column
+	}
+	v.diags = append(v.diags, d)
+}
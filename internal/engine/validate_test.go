@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidateFile(t *testing.T) {
+	const doc = "version: 0\non:\n  repositories: [owner/a, %s]\nsteps:\n  - %s\ncommit: {title: %q, body: b}\n"
+	cases := []struct {
+		name  string
+		repo  string
+		step  string
+		title string
+		want  []string // Paths of the diagnostics
+		valid bool
+	}{
+		{
+			name:  "valid",
+			repo:  "owner/b",
+			step:  "script: {run: echo}",
+			title: "t",
+			valid: true,
+		},
+		{
+			name:  "warning",
+			repo:  "Owner/A",
+			step:  "script: {run: echo}",
+			title: "t",
+			want:  []string{"on.repositories.1"},
+			valid: true,
+		},
+		{
+			name:  "schema and operator",
+			repo:  "owner/b",
+			step:  "script: {run: echo, shell: '{0}'}\n  - file: {action: nope, target: [a]}",
+			title: "t",
+			want:  []string{"steps.0", "steps.1.file.action"},
+		},
+		{
+			name:  "repository template",
+			repo:  "owner/b",
+			step:  "script: {run: 'echo {{ .Repository.Repo }}'}",
+			title: "chore: update {{ .Repository.Name }}",
+			valid: true,
+		},
+		{
+			name:  "unknown repository field",
+			repo:  "owner/b",
+			step:  "script: {run: 'echo {{ .Repository.Nope }}'}",
+			title: "t",
+			want:  []string{"steps.0.script.run"},
+		},
+		{
+			name:  "template",
+			repo:  "owner/b",
+			step:  "script: {run: echo}",
+			title: "{{ .Nope }",
+			want:  []string{"commit.title"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "plan.yml")
+			if err := os.WriteFile(name, []byte(fmt.Sprintf(doc, tc.repo, tc.step, tc.title)), 0644); err != nil {
+				t.Fatalf("failed to write plan: %v", err)
+			}
+			diags, err := ValidateFile(name)
+			if err != nil {
+				t.Fatalf("failed to validate: %v", err)
+			}
+			var paths []string
+			for _, d := range diags {
+				if d.Line == 0 {
+					t.Errorf("diagnostic is not located: %v", d)
+				}
+				paths = append(paths, d.Path)
+			}
+			if !slices.Equal(paths, tc.want) {
+				t.Errorf("unexpected diagnostics: got %v, want %v", diags, tc.want)
+			}
+
+			// NOTE: Plans are valid exactly when they can be applied
+			_, err = NewFromFile(name)
+			if gotValid := err == nil; gotValid != tc.valid {
+				t.Errorf("unexpected error when applying: %v", err)
+			}
+		})
+	}
+}
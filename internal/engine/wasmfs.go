@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	experimentalsys "github.com/tetratelabs/wazero/experimental/sys"
+	"github.com/tetratelabs/wazero/experimental/sysfs"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmGitDir is the directory of the worktree that is hidden from modules, as
+// its hooks and configuration are run by Git on the host.
+const wasmGitDir = ".git"
+
+// wasmFS is the worktree as mounted in a WebAssembly module. The Git directory
+// is hidden, and symlinks can neither be created nor traversed, so that the
+// module cannot reach any file outside of the worktree or make the host run
+// its code.
+type wasmFS struct {
+	experimentalsys.FS
+	dir string // Directory of the worktree on the host
+}
+
+func newWasmFS(dir string) *wasmFS {
+	return &wasmFS{FS: sysfs.DirFS(dir), dir: dir}
+}
+
+// check checks that the path is accessible to the module, where the final
+// element of the path is only followed if it is a symlink when follow is set.
+func (w *wasmFS) check(p string, follow bool) experimentalsys.Errno {
+	p = path.Clean(strings.TrimPrefix(p, "/"))
+	if p == "." {
+		return 0
+	}
+	elems := strings.Split(p, "/")
+	// NOTE: Case-insensitive filesystems resolve any case to the Git dir
+	if strings.EqualFold(elems[0], wasmGitDir) || elems[0] == ".." {
+		return experimentalsys.ENOENT
+	}
+	for i := range elems {
+		if i == len(elems)-1 && !follow {
+			break
+		}
+		fi, err := os.Lstat(filepath.Join(w.dir, filepath.FromSlash(strings.Join(elems[:i+1], "/"))))
+		if err != nil {
+			// NOTE: Missing paths are left to the filesystem to report
+			return 0
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return experimentalsys.ELOOP
+		}
+	}
+	return 0
+}
+
+func (w *wasmFS) OpenFile(p string, flag experimentalsys.Oflag, perm fs.FileMode) (experimentalsys.File, experimentalsys.Errno) {
+	if errno := w.check(p, true); errno != 0 {
+		return nil, errno
+	}
+	f, errno := w.FS.OpenFile(p, flag, perm)
+	if errno != 0 {
+		return nil, errno
+	}
+	if path.Clean(strings.TrimPrefix(p, "/")) == "." {
+		return &wasmRootFile{File: f}, 0
+	}
+	return f, 0
+}
+
+func (w *wasmFS) Lstat(p string) (sys.Stat_t, experimentalsys.Errno) {
+	if errno := w.check(p, false); errno != 0 {
+		return sys.Stat_t{}, errno
+	}
+	return w.FS.Lstat(p)
+}
+
+func (w *wasmFS) Stat(p string) (sys.Stat_t, experimentalsys.Errno) {
+	if errno := w.check(p, true); errno != 0 {
+		return sys.Stat_t{}, errno
+	}
+	return w.FS.Stat(p)
+}
+
+func (w *wasmFS) Mkdir(p string, perm fs.FileMode) experimentalsys.Errno {
+	if errno := w.check(p, true); errno != 0 {
+		return errno
+	}
+	return w.FS.Mkdir(p, perm)
+}
+
+func (w *wasmFS) Chmod(p string, perm fs.FileMode) experimentalsys.Errno {
+	if errno := w.check(p, true); errno != 0 {
+		return errno
+	}
+	return w.FS.Chmod(p, perm)
+}
+
+func (w *wasmFS) Rename(from, to string) experimentalsys.Errno {
+	if errno := w.check(from, false); errno != 0 {
+		return errno
+	}
+	if errno := w.check(to, false); errno != 0 {
+		return errno
+	}
+	return w.FS.Rename(from, to)
+}
+
+func (w *wasmFS) Rmdir(p string) experimentalsys.Errno {
+	if errno := w.check(p, false); errno != 0 {
+		return errno
+	}
+	return w.FS.Rmdir(p)
+}
+
+func (w *wasmFS) Unlink(p string) experimentalsys.Errno {
+	if errno := w.check(p, false); errno != 0 {
+		return errno
+	}
+	return w.FS.Unlink(p)
+}
+
+func (w *wasmFS) Link(oldPath, newPath string) experimentalsys.Errno {
+	if errno := w.check(oldPath, false); errno != 0 {
+		return errno
+	}
+	if errno := w.check(newPath, false); errno != 0 {
+		return errno
+	}
+	return w.FS.Link(oldPath, newPath)
+}
+
+func (w *wasmFS) Symlink(oldPath, linkName string) experimentalsys.Errno {
+	return experimentalsys.EPERM
+}
+
+func (w *wasmFS) Readlink(p string) (string, experimentalsys.Errno) {
+	if errno := w.check(p, false); errno != 0 {
+		return "", errno
+	}
+	return w.FS.Readlink(p)
+}
+
+func (w *wasmFS) Utimens(p string, atim, mtim int64) experimentalsys.Errno {
+	if errno := w.check(p, true); errno != 0 {
+		return errno
+	}
+	return w.FS.Utimens(p, atim, mtim)
+}
+
+// wasmRootFile is the root directory of the worktree, which does not list the
+// Git directory.
+type wasmRootFile struct {
+	experimentalsys.File
+}
+
+func (f *wasmRootFile) Readdir(n int) ([]experimentalsys.Dirent, experimentalsys.Errno) {
+	for {
+		dirents, errno := f.File.Readdir(n)
+		if errno != 0 || len(dirents) == 0 {
+			return dirents, errno
+		}
+		// NOTE: An empty result would end the listing, so the next entries
+		// are read if only the Git directory was read
+		dirents = slices.DeleteFunc(dirents, func(d experimentalsys.Dirent) bool {
+			return strings.EqualFold(d.Name, wasmGitDir)
+		})
+		if len(dirents) > 0 {
+			return dirents, 0
+		}
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"time"
 )
 
-// FIXME: When commit signing is enabled, tests may fail due to interactive input.
 func TestApply(t *testing.T) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -25,7 +24,7 @@ func TestApply(t *testing.T) {
 
 	var stdout, stderr bytes.Buffer
 
-	cmd := exec.Command("bulk", "apply", "--key", id, "--force", "./testdata/0001-update-timestamp.yml")
+	cmd := exec.Command("bulk", "apply", "--key", id, "--force", "--no-sign", "./testdata/0001-update-timestamp.yml")
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 